@@ -22,12 +22,16 @@ var (
 	cbs = make([]func(), 0)
 	mtx = &sync.RWMutex{}
 	p   = yaml.Parser()
+	// confPath is the conf file loaded by LoadConf, changes pushed by apis are written to it
+	confPath = "conf/conf.yaml"
 )
 
-func init() {
-	f := file.Provider("conf/conf.yaml")
+// LoadConf loads conf from file at path and watches its changes, it must be called before using conf
+func LoadConf(path string) error {
+	confPath = path
+	f := file.Provider(path)
 	if err := k.Load(f, p); err != nil {
-		log.Fatalln(err)
+		return err
 	}
 	f.Watch(func(event interface{}, err error) {
 		if err != nil {
@@ -37,6 +41,8 @@ func init() {
 		k.Load(f, p)
 		doCallbacks()
 	})
+
+	return nil
 }
 
 func doCallbacks() {
@@ -80,7 +86,9 @@ func GetSenders() (senders []map[string]string, err error) {
 	defer mtx.RUnlock()
 
 	typedSenders := make(map[string][]map[string]string, 0)
-	err = k.Unmarshal("senders", &typedSenders)
+	if err = k.Unmarshal("senders", &typedSenders); err != nil {
+		return
+	}
 
 	senders = make([]map[string]string, 0)
 	for t, ss := range typedSenders {
@@ -90,13 +98,66 @@ func GetSenders() (senders []map[string]string, err error) {
 		}
 	}
 
+	// senders of tenants are marked with their tenant names
+	tenants, err := getTenants()
+	for _, tenant := range tenants {
+		for t, ss := range tenant.Senders {
+			for _, s := range ss {
+				s["type"], s["tenant"] = t, tenant.Name
+				senders = append(senders, s)
+			}
+		}
+	}
+
+	return
+}
+
+type IntegrationRule struct {
+	Match     map[string]string `koanf:"match" json:"match"`
+	Tos       []string          `koanf:"tos" json:"tos"`
+	Ats       []string          `koanf:"ats" json:"ats"`
+	AtMobiles []string          `koanf:"at_mobiles" json:"at_mobiles"`
+}
+
+type IntegrationConf struct {
+	Sender   string             `koanf:"sender" json:"sender"`
+	Template string             `koanf:"template" json:"template"`
+	Rules    []*IntegrationRule `koanf:"rules" json:"rules"`
+}
+
+// GetIntegrationConf returns the integration conf of tenant, the top level one is used for the default tenant
+func GetIntegrationConf(tenant, name string) (conf *IntegrationConf, err error) {
+	if tenant != "" {
+		t, err := GetTenant(tenant)
+		if err != nil {
+			return nil, err
+		}
+		return lo.Ternary(t.Integrations[name] != nil, t.Integrations[name], &IntegrationConf{}), nil
+	}
+
+	mtx.RLock()
+	defer mtx.RUnlock()
+
+	conf = &IntegrationConf{}
+	err = k.Unmarshal(fmt.Sprintf("integrations.%s", name), conf)
+
+	return
+}
+
+func GetTemplates() (templates map[string]string, err error) {
+	mtx.RLock()
+	defer mtx.RUnlock()
+
+	templates = make(map[string]string)
+	err = k.Unmarshal("templates", &templates)
+
 	return
 }
 
 // PushRemoteConf
 //
 //	@Tags			conf
-//	@Description	push a conf to overwrite(POST), update(PUT) or delete(DELETE) existing conf of senders
+//	@Description	push a conf to overwrite(POST), update(PUT) or delete(DELETE) existing conf of senders of the authenticated tenant
 //	@Description	https://github.com/veops/messenger?tab=readme-ov-file#更新配置
 //	@Accept			json
 //	@Param			body body	map[string][]map[string]string	true "senders config, eg. {wechatBot: [{name: yourSenderName, url: https://xxx}]}"
@@ -115,9 +176,23 @@ func PushRemoteConf(ctx *gin.Context) {
 	mtx.Lock()
 	defer mtx.Unlock()
 
+	tenantName := ctx.GetString(TenantKey)
+	tenants, err := getTenants()
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	tenant, _ := lo.Find(tenants, func(t *Tenant) bool { return t.Name == tenantName })
 	pre, cur := make(map[string][]map[string]string), make(map[string][]map[string]string)
-	k.Unmarshal("senders", &pre)
-	k.Unmarshal("senders", &cur)
+	if tenant != nil {
+		pre, cur = lo.Assign(tenant.Senders), lo.Assign(tenant.Senders)
+	} else if tenantName != "" {
+		ctx.AbortWithError(http.StatusBadRequest, fmt.Errorf("cannot find tenant with name %s", tenantName))
+		return
+	} else {
+		k.Unmarshal("senders", &pre)
+		k.Unmarshal("senders", &cur)
+	}
 	switch ctx.Request.Method {
 	case "POST":
 		for t, ss := range update {
@@ -154,21 +229,28 @@ func PushRemoteConf(ctx *gin.Context) {
 		return
 	}
 
-	m := lo.MapEntries(cur, func(k string, v []map[string]string) (string, any) { return fmt.Sprintf("senders.%s", k), v })
-
-	if err := k.Load(confmap.Provider(m, "."), nil); err != nil {
+	if tenant != nil {
+		tenant.Senders = cur
+		err = saveTenants(tenants)
+	} else {
+		err = saveConf(lo.MapEntries(cur, func(k string, v []map[string]string) (string, any) { return fmt.Sprintf("senders.%s", k), v }))
+	}
+	if err != nil {
 		ctx.AbortWithError(http.StatusInternalServerError, err)
 		return
 	}
+}
+
+// saveConf loads m into conf and writes conf to file, the caller must hold mtx
+func saveConf(m map[string]any) error {
+	if err := k.Load(confmap.Provider(m, "."), nil); err != nil {
+		return err
+	}
 
 	bs, err := k.Marshal(p)
 	if err != nil {
-		ctx.AbortWithError(http.StatusInternalServerError, err)
-		return
+		return err
 	}
 
-	if err = os.WriteFile("conf/conf.yaml", bs, 0666); err != nil {
-		ctx.AbortWithError(http.StatusInternalServerError, err)
-		return
-	}
+	return os.WriteFile(confPath, bs, 0666)
 }
@@ -0,0 +1,258 @@
+package global
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/samber/lo"
+)
+
+const (
+	// TenantKey is the key of authenticated tenant name in gin context, it is empty for the default tenant
+	TenantKey = "tenant"
+)
+
+// Tenant is a namespace with its own senders, auths, integrations and status webhooks,
+// the default tenant with empty name consists of the top level conf
+type Tenant struct {
+	Name           string                         `koanf:"name" json:"name"`
+	Auths          []map[string]string            `koanf:"auths" json:"auths"`
+	Senders        map[string][]map[string]string `koanf:"senders" json:"senders"`
+	Integrations   map[string]*IntegrationConf    `koanf:"integrations" json:"integrations"`
+	StatusWebhooks []map[string]string            `koanf:"statusWebhooks" json:"statusWebhooks"`
+}
+
+func GetTenants() (tenants []*Tenant, err error) {
+	mtx.RLock()
+	defer mtx.RUnlock()
+
+	return getTenants()
+}
+
+func getTenants() (tenants []*Tenant, err error) {
+	tenants = make([]*Tenant, 0)
+	err = k.Unmarshal("tenants", &tenants)
+
+	return
+}
+
+// GetTenant returns the tenant with name, the default tenant is returned if name is empty
+func GetTenant(name string) (t *Tenant, err error) {
+	if name != "" {
+		tenants, err := GetTenants()
+		if err != nil {
+			return nil, err
+		}
+		t, ok := lo.Find(tenants, func(t *Tenant) bool { return t.Name == name })
+		if !ok {
+			return nil, fmt.Errorf("cannot find tenant with name %s", name)
+		}
+		return t, nil
+	}
+
+	mtx.RLock()
+	defer mtx.RUnlock()
+
+	t = &Tenant{}
+	for key, v := range map[string]any{"auths": &t.Auths, "senders": &t.Senders, "integrations": &t.Integrations, "statusWebhooks": &t.StatusWebhooks} {
+		if err = k.Unmarshal(key, v); err != nil {
+			return nil, err
+		}
+	}
+
+	return
+}
+
+// saveTenants overwrites tenants in conf, the caller must hold mtx
+func saveTenants(tenants []*Tenant) error {
+	// tenants are loaded as plain maps so that they are marshaled with the same keys as conf
+	bs, _ := json.Marshal(tenants)
+	m := make([]map[string]any, 0)
+	if err := json.Unmarshal(bs, &m); err != nil {
+		return err
+	}
+	return saveConf(map[string]any{"tenants": m})
+}
+
+// QueryTenant
+//
+//	@Tags			conf
+//	@Description	query tenants without secrets, it is only allowed for the default tenant
+//	@Produce		json
+//	@Success		200	{object}	map[string]any	"a map with msg info and tenants, eg. {msg:ok,tenants:[]}"
+//	@Router			/v1/tenants [GET]
+func QueryTenant(ctx *gin.Context) {
+	if !isAdmin(ctx) {
+		return
+	}
+	tenants, err := GetTenants()
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, map[string]any{"tenants": lo.Map(tenants, func(t *Tenant, _ int) *Tenant { return t.withoutSecrets() })})
+}
+
+// withoutSecrets returns a copy of tenant without tokens, secrets and sender credentials,
+// only types and ip patterns of auths and names of senders are kept
+func (t *Tenant) withoutSecrets() *Tenant {
+	return &Tenant{
+		Name: t.Name,
+		Auths: lo.Map(t.Auths, func(a map[string]string, _ int) map[string]string {
+			return lo.PickByKeys(a, []string{"type", "pattern"})
+		}),
+		Senders: lo.MapValues(t.Senders, func(ss []map[string]string, _ string) []map[string]string {
+			return lo.Map(ss, func(s map[string]string, _ int) map[string]string { return lo.PickByKeys(s, []string{"name"}) })
+		}),
+		Integrations: t.Integrations,
+		StatusWebhooks: lo.Map(t.StatusWebhooks, func(h map[string]string, _ int) map[string]string {
+			return lo.OmitByKeys(h, []string{"secret"})
+		}),
+	}
+}
+
+// authRules returns the token and sign rules of auths, eg. token:xxx, a request matching the same rule of different tenants is ambiguous
+func authRules(auths []map[string]string) []string {
+	return lo.FlatMap(auths, func(a map[string]string, _ int) []string {
+		switch a["type"] {
+		case "token":
+			return []string{"token:" + a["token"]}
+		case "sign":
+			return []string{"sign:" + a["secret"]}
+		}
+		return nil
+	})
+}
+
+// ipPatterns returns the ip patterns of auths, eg. 192.168.*.*
+func ipPatterns(auths []map[string]string) []string {
+	return lo.FlatMap(auths, func(a map[string]string, _ int) []string {
+		if a["type"] != "ip" {
+			return nil
+		}
+		return lo.Compact(lo.Map(strings.Split(a["pattern"], ","), func(p string, _ int) string { return strings.TrimSpace(p) }))
+	})
+}
+
+// ipOverlap reports whether an ip could match both patterns, each segment of patterns is either * or a fixed value
+func ipOverlap(p1, p2 string) bool {
+	ss1, ss2 := strings.Split(p1, "."), strings.Split(p2, ".")
+	if len(ss1) != len(ss2) {
+		return false
+	}
+	for i := range ss1 {
+		if ss1[i] != "*" && ss2[i] != "*" && ss1[i] != ss2[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// PushTenant
+//
+//	@Tags			conf
+//	@Description	add or replace a tenant, it is only allowed for the default tenant
+//	@Accept			json
+//	@Produce		json
+//	@Param			body	body		Tenant				true	" "
+//	@Success		200		{object}	map[string]string	"a map with msg info, eg. {msg:ok}"
+//	@Router			/v1/tenants [POST]
+func PushTenant(ctx *gin.Context) {
+	if !isAdmin(ctx) {
+		return
+	}
+	t := &Tenant{}
+	if err := ctx.ShouldBindBodyWith(t, binding.JSON); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	if t.Name == "" || strings.Contains(t.Name, "/") {
+		ctx.AbortWithError(http.StatusBadRequest, fmt.Errorf("tenant name is required and cannot contain /"))
+		return
+	}
+	if dup := lo.FindDuplicates(lo.FlatMap(lo.Values(t.Senders), func(ss []map[string]string, _ int) []string {
+		return lo.Map(ss, func(s map[string]string, _ int) string { return s["name"] })
+	})); len(dup) > 0 {
+		ctx.AbortWithError(http.StatusBadRequest, fmt.Errorf("duplicate sender name = %v", dup))
+		return
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	tenants, err := getTenants()
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	auths := make([]map[string]string, 0)
+	if err = k.Unmarshal("auths", &auths); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	// anyone could act as the default tenant without auths, then tenants are not isolated
+	if len(auths) <= 0 {
+		ctx.AbortWithError(http.StatusBadRequest, fmt.Errorf("auths of the default tenant are required to add tenants"))
+		return
+	}
+	// requests are authenticated as the first tenant matching them, so rules of a tenant must not be used by others
+	others := lo.Filter(tenants, func(v *Tenant, _ int) bool { return v.Name != t.Name })
+	usedAuths := append(auths, lo.FlatMap(others, func(v *Tenant, _ int) []map[string]string { return v.Auths })...)
+	if dup := lo.Intersect(authRules(usedAuths), authRules(t.Auths)); len(dup) > 0 {
+		ctx.AbortWithError(http.StatusBadRequest, fmt.Errorf("auths are used by other tenants, type = %v", lo.Uniq(lo.Map(dup, func(r string, _ int) string {
+			return strings.SplitN(r, ":", 2)[0]
+		}))))
+		return
+	}
+	// ip patterns matching a same ip, eg. 192.168.*.* and 192.168.1.1, are ambiguous as well
+	used := ipPatterns(usedAuths)
+	for _, p := range ipPatterns(t.Auths) {
+		if u, ok := lo.Find(used, func(u string) bool { return ipOverlap(u, p) }); ok {
+			ctx.AbortWithError(http.StatusBadRequest, fmt.Errorf("ip pattern %s overlaps with %s used by other tenants", p, u))
+			return
+		}
+	}
+	tenants = append(others, t)
+	if err = saveTenants(tenants); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+}
+
+// DeleteTenant
+//
+//	@Tags			conf
+//	@Description	delete a tenant, it is only allowed for the default tenant, histories of the tenant are kept
+//	@Param			name	path		string				true	"tenant name"
+//	@Success		200		{object}	map[string]string	"a map with msg info, eg. {msg:ok}"
+//	@Router			/v1/tenants/{name} [DELETE]
+func DeleteTenant(ctx *gin.Context) {
+	if !isAdmin(ctx) {
+		return
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	tenants, err := getTenants()
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if err = saveTenants(lo.Filter(tenants, func(v *Tenant, _ int) bool { return v.Name != ctx.Param("name") })); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+}
+
+func isAdmin(ctx *gin.Context) bool {
+	if ctx.GetString(TenantKey) != "" {
+		ctx.AbortWithError(http.StatusForbidden, fmt.Errorf("tenants are only managed by the default tenant"))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,83 @@
+package global
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knadh/koanf/providers/confmap"
+)
+
+func TestPushTenantAuths(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer k.Delete("")
+
+	push := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/tenants", bytes.NewBufferString(body))
+		PushTenant(ctx)
+		return w
+	}
+
+	if w := push(`{"name":"a","auths":[{"type":"token","token":"a"}]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("tenant without auths of the default tenant, code = %d", w.Code)
+	}
+
+	k.Load(confmap.Provider(map[string]any{
+		"auths": []map[string]any{{"type": "token", "token": "admin"}, {"type": "ip", "pattern": "127.0.0.1"}},
+		"tenants": []map[string]any{
+			{"name": "a", "auths": []map[string]any{{"type": "token", "token": "a"}}},
+		},
+	}, "."), nil)
+	for _, body := range []string{
+		`{"name":"b","auths":[{"type":"token","token":"admin"}]}`,
+		`{"name":"b","auths":[{"type":"token","token":"a"}]}`,
+		`{"name":"b","auths":[{"type":"ip","pattern":"10.0.0.1,127.0.0.1"}]}`,
+		`{"name":"b","auths":[{"type":"ip","pattern":"127.0.*.*"}]}`,
+	} {
+		if w := push(body); w.Code != http.StatusBadRequest {
+			t.Errorf("push %s, code = %d", body, w.Code)
+		}
+	}
+}
+
+func TestIpOverlap(t *testing.T) {
+	tests := []struct {
+		p1, p2 string
+		want   bool
+	}{
+		{"127.0.0.1", "127.0.0.1", true},
+		{"192.168.*.*", "192.168.1.1", true},
+		{"192.*.1.*", "*.168.*.2", true},
+		{"192.168.1.*", "192.168.2.*", false},
+		{"10.0.0.1", "10.0.0.2", false},
+		{"*.*.*.*", "::1", false},
+	}
+	for _, tt := range tests {
+		if got := ipOverlap(tt.p1, tt.p2); got != tt.want {
+			t.Errorf("ipOverlap(%s, %s) = %v, want %v", tt.p1, tt.p2, got, tt.want)
+		}
+	}
+}
+
+func TestTenantWithoutSecrets(t *testing.T) {
+	tenant := &Tenant{
+		Name:           "a",
+		Auths:          []map[string]string{{"type": "token", "token": "a"}, {"type": "ip", "pattern": "127.0.0.1"}},
+		Senders:        map[string][]map[string]string{"wechatBot": {{"name": "bot", "url": "https://xxx?key=xxx"}}},
+		StatusWebhooks: []map[string]string{{"url": "https://xxx", "secret": "xxx"}},
+	}
+	want := &Tenant{
+		Name:           "a",
+		Auths:          []map[string]string{{"type": "token"}, {"type": "ip", "pattern": "127.0.0.1"}},
+		Senders:        map[string][]map[string]string{"wechatBot": {{"name": "bot"}}},
+		StatusWebhooks: []map[string]string{{"url": "https://xxx"}},
+	}
+	if got := tenant.withoutSecrets(); !reflect.DeepEqual(got, want) {
+		t.Errorf("withoutSecrets = %+v, want %+v", got, want)
+	}
+}
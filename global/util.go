@@ -1,8 +1,44 @@
 package global
 
-import "encoding/json"
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/samber/lo"
+)
 
 func RenderPretty(a any) string {
 	bs, _ := json.MarshalIndent(a, "", " ")
 	return string(bs)
 }
+
+// SignValues converts body to string values to sign, values which are not string are signed as compact json
+func SignValues(body map[string]any) map[string]string {
+	return lo.MapValues(body, func(v any, _ string) string {
+		if s, ok := v.(string); ok {
+			return s
+		}
+		bs, _ := json.Marshal(v)
+		return string(bs)
+	})
+}
+
+// Sign signs body with ts and nonce, it's the algorithm of sign auth
+//
+//	https://github.com/veops/messenger?tab=readme-ov-file#sign
+func Sign(secret string, body map[string]string, ts, nonce string) string {
+	body = lo.Assign(body, map[string]string{"nonce": nonce, "ts": ts})
+
+	keys := lo.Keys(body)
+	sort.Strings(keys)
+	kvStr := strings.Join(lo.Map(keys, func(k string, _ int) string { return fmt.Sprintf("%s%s", k, body[k]) }), "")
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte(kvStr))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -20,6 +20,9 @@ import (
 //	@externalDocs.description	Messenger README
 //	@externalDocs.url			https://github.com/veops/messenger?tab=readme-ov-file#messenger
 func main() {
+	if err := global.LoadConf("conf/conf.yaml"); err != nil {
+		log.Fatalln(err)
+	}
 	authConf, err := global.GetAuthConf()
 	if err != nil {
 		log.Fatalln(err)
@@ -35,16 +38,45 @@ func main() {
 	g1 := r.Group("/v1").Use(middleware.Auth(authConf), middleware.Error2Resp())
 	{
 		g1.POST("/message", send.PushMessage)
+		g1.POST("/messages/batch", send.BatchPushMessage)
+		g1.PATCH("/message/:id", send.UpdateMessage)
+		g1.DELETE("/message/:id", send.RecallMessage)
 		g1.POST("/uid/getbyphone", send.GetUIDByPhone)
+		g1.POST("/uid/lookup", send.LookupUID)
+		g1.POST("/integrations/alertmanager", send.Alertmanager)
+		g1.POST("/integrations/grafana", send.Grafana)
+		g1.POST("/integrations/zabbix", send.Zabbix)
+		g1.GET("/callbacks", send.QueryCallback)
+		g1.GET("/contacts", send.QueryContact)
+		g1.POST("/contacts", send.AddContact)
+		g1.PUT("/contacts/:id", send.UpdateContact)
+		g1.DELETE("/contacts/:id", send.DeleteContact)
+		g1.GET("/groups", send.QueryGroup)
+		g1.POST("/groups", send.AddGroup)
+		g1.PUT("/groups/:id", send.UpdateGroup)
+		g1.DELETE("/groups/:id", send.DeleteGroup)
+		g1.GET("/preferences", send.QueryPreference)
+		g1.PUT("/preferences/:contact", send.SetPreference)
+		g1.DELETE("/preferences/:contact", send.DeletePreference)
 
 		g1.POST("/senders", global.PushRemoteConf)
 		g1.PUT("/senders", global.PushRemoteConf)
 		g1.DELETE("/senders", global.PushRemoteConf)
+
+		g1.GET("/tenants", global.QueryTenant)
+		g1.POST("/tenants", global.PushTenant)
+		g1.DELETE("/tenants/:name", global.DeleteTenant)
 	}
-	g2 := r.Group("/v1").Use(middleware.Error2Resp())
-	{
-		g2.GET("/histories", send.QueryHistory)
-	}
+	// histories are queried by the web page which cannot send tokens or signatures
+	r.GET("/v1/histories", middleware.WebAuth(authConf), middleware.Error2Resp(), send.QueryHistory)
+	// events are streamed without Error2Resp which buffers the response
+	r.GET("/v1/events", middleware.Auth(authConf), send.Events)
+	// callbacks are verified by vendor signatures and answered in vendor formats
+	r.GET("/v1/callback/:sender", send.ReceiveCallback)
+	r.POST("/v1/callback/:sender", send.ReceiveCallback)
+	// unsubscription links in emails are verified by their tokens
+	r.GET("/v1/unsubscribe", send.UnsubscribeForm)
+	r.POST("/v1/unsubscribe", send.Unsubscribe)
 
 	r.StaticFile("/web", "./web/build/index.html")
 	r.StaticFile("/manifest.json", "./web/build/manifest.json")
@@ -60,6 +92,7 @@ func main() {
 
 	eg := &errgroup.Group{}
 	eg.Go(send.Start)
+	eg.Go(send.StartPoller)
 	eg.Go(func() error {
 		return r.Run(fmt.Sprintf("%s:%s", appConf["ip"], appConf["port"]))
 	})
@@ -1,12 +1,7 @@
 package middleware
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/base64"
-	"fmt"
 	"net/http"
-	"sort"
 	"strings"
 	"time"
 
@@ -14,26 +9,97 @@ import (
 	"github.com/gin-gonic/gin/binding"
 	"github.com/samber/lo"
 	"github.com/spf13/cast"
+
+	"github.com/veops/messenger/global"
 )
 
+// Auth authenticates with auths of tenants at first, then confs of the default tenant,
+// the name of authenticated tenant is set in context with key global.TenantKey
 func Auth(confs []map[string]string) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		if len(confs) <= 0 {
-			ctx.Next()
+		tenant, code, err := authenticate(confs, ctx)
+		if err != nil {
+			ctx.AbortWithError(code, err)
+			return
+		}
+		if code != http.StatusOK {
+			ctx.AbortWithStatus(code)
 			return
 		}
-		for _, conf := range confs {
-			t := cast.ToString(conf["type"])
-			if type2auth[t] == nil || !type2auth[t](conf, ctx) {
-				continue
+		if tenant != "" {
+			ctx.Set(global.TenantKey, tenant)
+		}
+		ctx.Next()
+	}
+}
+
+// WebAuth is Auth for read-only apis used by the web page which cannot send tokens or signatures,
+// unauthenticated requests are regarded as the default tenant unless webAuth of app conf is true
+func WebAuth(confs []map[string]string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		tenant, code, err := authenticate(confs, ctx)
+		if err != nil {
+			ctx.AbortWithError(code, err)
+			return
+		}
+		if code == http.StatusUnauthorized {
+			appConf, err := global.GetAppConf()
+			if err != nil {
+				ctx.AbortWithError(http.StatusInternalServerError, err)
+				return
 			}
-			ctx.Next()
+			if cast.ToBool(appConf["webAuth"]) {
+				ctx.AbortWithStatus(code)
+				return
+			}
+			tenant, code = "", http.StatusOK
+		}
+		if code != http.StatusOK {
+			ctx.AbortWithStatus(code)
 			return
 		}
-		ctx.AbortWithStatus(http.StatusUnauthorized)
+		if tenant != "" {
+			ctx.Set(global.TenantKey, tenant)
+		}
+		ctx.Next()
 	}
 }
 
+// authenticate returns the name of authenticated tenant, which is empty for the default tenant, and the status code
+func authenticate(confs []map[string]string, ctx *gin.Context) (string, int, error) {
+	tenants, err := global.GetTenants()
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	for _, t := range tenants {
+		if len(t.Auths) > 0 && authBy(t.Auths, ctx) {
+			return t.Name, http.StatusOK, nil
+		}
+	}
+	// anonymous callers cannot act as the default tenant which could access all tenants when tenants are configured
+	if len(confs) <= 0 && len(tenants) > 0 {
+		return "", http.StatusUnauthorized, nil
+	}
+	if len(confs) > 0 && !authBy(confs, ctx) {
+		return "", http.StatusUnauthorized, nil
+	}
+	// the default tenant could act as another tenant with X-Tenant
+	if name := ctx.GetHeader("X-Tenant"); name != "" {
+		if !lo.ContainsBy(tenants, func(t *global.Tenant) bool { return t.Name == name }) {
+			return "", http.StatusForbidden, nil
+		}
+		return name, http.StatusOK, nil
+	}
+	return "", http.StatusOK, nil
+}
+
+func authBy(confs []map[string]string, ctx *gin.Context) bool {
+	return lo.SomeBy(confs, func(conf map[string]string) bool {
+		t := cast.ToString(conf["type"])
+		return type2auth[t] != nil && type2auth[t](conf, ctx)
+	})
+}
+
 var (
 	type2auth = map[string]func(map[string]string, *gin.Context) bool{
 		"ip":    authByIP,
@@ -65,7 +131,8 @@ func authByIP(conf map[string]string, ctx *gin.Context) bool {
 }
 
 func authByToken(conf map[string]string, ctx *gin.Context) bool {
-	return conf["token"] != "" && conf["token"] == ctx.GetHeader("X-Token")
+	// Authorization bearer is accepted for webhooks which cannot set custom headers, eg. alertmanager
+	return conf["token"] != "" && lo.Contains([]string{ctx.GetHeader("X-Token"), strings.TrimPrefix(ctx.GetHeader("Authorization"), "Bearer ")}, conf["token"])
 }
 
 func authBySign(conf map[string]string, ctx *gin.Context) bool {
@@ -76,19 +143,12 @@ func authBySign(conf map[string]string, ctx *gin.Context) bool {
 		return false
 	}
 
-	body := make(map[string]string)
-	if ctx.ShouldBindBodyWith(&body, binding.JSON) != nil {
+	raw := make(map[string]any)
+	if ctx.ShouldBindBodyWith(&raw, binding.JSON) != nil {
 		return false
 	}
+	// values which are not string, eg. tos and messages of batch, are signed as compact json
+	body := global.SignValues(raw)
 
-	body["nonce"] = ctx.GetHeader("X-Nonce")
-	body["ts"] = ctx.GetHeader("X-TS")
-
-	keys := lo.Keys(body)
-	sort.Strings(keys)
-	kvStr := strings.Join(lo.Map(keys, func(k string, _ int) string { return fmt.Sprintf("%s%s", k, body[k]) }), "")
-
-	mac := hmac.New(sha256.New, []byte(conf["secret"]))
-	_, _ = mac.Write([]byte(kvStr))
-	return ctx.GetHeader("X-Sign") == base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return ctx.GetHeader("X-Sign") == global.Sign(conf["secret"], body, ctx.GetHeader("X-TS"), ctx.GetHeader("X-Nonce"))
 }
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/veops/messenger/global"
+)
+
+func TestWebAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	confs := []map[string]string{{"type": "token", "token": "admin"}}
+	r := gin.New()
+	handler := func(ctx *gin.Context) { ctx.String(http.StatusOK, ctx.GetString(global.TenantKey)) }
+	r.GET("/auth", Auth(confs), handler)
+	r.GET("/web", WebAuth(confs), handler)
+
+	tests := []struct {
+		path    string
+		headers map[string]string
+		code    int
+		tenant  string
+	}{
+		{"/auth", nil, http.StatusUnauthorized, ""},
+		{"/web", nil, http.StatusOK, ""},
+		{"/web", map[string]string{"X-Tenant": "a"}, http.StatusOK, ""},
+		{"/web", map[string]string{"X-Token": "admin", "X-Tenant": "a"}, http.StatusForbidden, ""},
+		{"/web", map[string]string{"X-Token": "admin"}, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+		r.ServeHTTP(w, req)
+		if w.Code != tt.code || (w.Code == http.StatusOK && w.Body.String() != tt.tenant) {
+			t.Errorf("%s %v, code = %d, tenant = %s", tt.path, tt.headers, w.Code, w.Body.String())
+		}
+	}
+}
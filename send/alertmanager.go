@@ -0,0 +1,30 @@
+package send
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// Alertmanager
+//
+//	@Tags			integration
+//	@Description	receive alerts from prometheus alertmanager webhook, render and send them with the sender in query or integration conf
+//	@Description	https://prometheus.io/docs/alerting/latest/configuration/#webhook_config
+//	@Accept			json
+//	@Produce		json
+//	@Param			sender		query		string				false	"sender name, default is the sender of integrations.alertmanager in conf"
+//	@Param			template	query		string				false	"template name in templates of conf, default is the builtin template"
+//	@Param			body		body		alertGroup			true	" "
+//	@Success		200			{object}	map[string]string	"a map with msg info, eg. {msg:ok}"
+//	@Router			/v1/integrations/alertmanager [POST]
+func Alertmanager(ctx *gin.Context) {
+	g := &alertGroup{}
+	if err := ctx.ShouldBindBodyWith(g, binding.JSON); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	pushAlerts(ctx, "alertmanager", g)
+}
@@ -1,13 +1,8 @@
 package send
 
 import (
-	"crypto/hmac"
-	"crypto/sha1"
-	"encoding/base64"
+	"encoding/json"
 	"fmt"
-	"math/rand"
-	"net/url"
-	"sort"
 	"strings"
 	"time"
 
@@ -17,6 +12,8 @@ import (
 
 const (
 	aliSmsUrl = "http://dysmsapi.aliyuncs.com"
+	// aliSmsBatchSize is the max count of phone numbers of SendBatchSms
+	aliSmsBatchSize = 100
 )
 
 func init() {
@@ -39,50 +36,132 @@ func (a *aliSms) send(msg *message) error {
 		"TemplateCode":  a.conf["templateCode"],
 		"TemplateParam": msg.Content,
 	}
-	req := rc.SetPreRequestHook(RecordHttpReq(msg)).R().
-		SetHeader("Content-Type", "application/x-www-form-urlencoded").
-		SetQueryParams(map[string]string{
-			"Action":           "SendSms",
-			"Version":          "2017-05-25",
-			"Format":           "JSON",
-			"AccessKeyId":      a.conf["accessKey"],
-			"SignatureNonce":   cast.ToString(rand.Int63()),
-			"Timestamp":        time.Now().UTC().Format("2006-01-02T15:04:05Z"),
-			"SignatureMethod":  "HMAC-SHA1",
-			"SignatureVersion": "1.0",
-			"AcceptLanguage":   "zh-CN",
-		}).
-		SetFormData(body)
-	ks := lo.Keys(body)
-	for k := range req.QueryParam {
-		ks = append(ks, k)
+	req := aliyunRPC(recordedR(msg), a.conf, "SendSms", "2017-05-25", body)
+
+	resp, err := req.Post(getURL(a.conf, "baseUrl", aliSmsUrl, ""))
+
+	RecordResp(msg, err, resp)
+
+	if err = handleErr("send to ali sms failed", err, resp, func(dt map[string]any) bool { return dt["Code"] == "OK" }); err != nil {
+		return err
 	}
-	sort.Strings(ks)
-	encodeParams := make([]string, 0)
-	for _, k := range ks {
-		v, ok := body[k]
-		if !ok {
-			v = req.QueryParam.Get(k)
+
+	// Code OK only means the request is accepted, delivery receipts are polled with BizId
+	dt := make(map[string]any)
+	_ = json.Unmarshal(resp.Body(), &dt)
+	msg.VendorId = cast.ToString(dt["BizId"])
+	msg.Recipients = newRecipients(msg.Tos, recipientPending)
+
+	return nil
+}
+
+// sendBatch sends messages with SendBatchSms, every phone number is sent with the template params of its message
+//
+//	https://help.aliyun.com/zh/sms/developer-reference/api-dysmsapi-2017-05-25-sendbatchsms
+func (a *aliSms) sendBatch(msgs []*message) {
+	// template params of each message are put into TemplateParamJson, so invalid ones fail the message only
+	msgs = lo.Filter(msgs, func(m *message, _ int) bool {
+		if m.Content != "" && !json.Valid([]byte(m.Content)) {
+			m.Err = fmt.Errorf("content of ali sms must be json of template params")
+			return false
+		}
+		return true
+	})
+	for _, chunk := range chunkByTos(msgs, aliSmsBatchSize) {
+		// SendSms accepts more phone numbers than SendBatchSms
+		if len(chunk) == 1 {
+			chunk[0].Err = a.send(chunk[0])
+			continue
+		}
+		phones, signNames, params := make([]string, 0), make([]string, 0), make([]json.RawMessage, 0)
+		for _, m := range chunk {
+			for _, to := range m.Tos {
+				phones = append(phones, to)
+				signNames = append(signNames, a.conf["signName"])
+				params = append(params, json.RawMessage(lo.Ternary(m.Content != "", m.Content, "{}")))
+			}
+		}
+		phoneJson, _ := json.Marshal(phones)
+		signNameJson, _ := json.Marshal(signNames)
+		paramJson, err := json.Marshal(params)
+		if err != nil {
+			lo.ForEach(chunk, func(m *message, _ int) { m.Err = err })
+			continue
+		}
+
+		first := chunk[0]
+		req := aliyunRPC(recordedR(first), a.conf, "SendBatchSms", "2017-05-25", map[string]string{
+			"PhoneNumberJson":   string(phoneJson),
+			"SignNameJson":      string(signNameJson),
+			"TemplateCode":      a.conf["templateCode"],
+			"TemplateParamJson": string(paramJson),
+		})
+
+		resp, err := req.Post(getURL(a.conf, "baseUrl", aliSmsUrl, ""))
+
+		RecordResp(first, err, resp)
+
+		err = handleErr("send batch to ali sms failed", err, resp, func(dt map[string]any) bool { return dt["Code"] == "OK" })
+		dt := make(map[string]any)
+		if err == nil {
+			_ = json.Unmarshal(resp.Body(), &dt)
+		}
+		for _, m := range chunk {
+			m.Req, m.Resp, m.Err = first.Req, first.Resp, err
+			if err == nil {
+				m.VendorId = cast.ToString(dt["BizId"])
+				m.Recipients = newRecipients(m.Tos, recipientPending)
+			}
 		}
-		encodeParams = append(encodeParams, fmt.Sprintf("%s=%s", url.QueryEscape(k), url.QueryEscape(v)))
 	}
-	CanonicalizedQueryString := strings.Join(encodeParams, "&")
-	stringToSign := fmt.Sprintf("%s&%s&%s",
-		"POST",
-		url.QueryEscape("/"),
-		url.QueryEscape(CanonicalizedQueryString),
-	)
-	hashed := hmac.New(sha1.New, []byte(a.conf["accessSecret"]+"&"))
-	hashed.Write([]byte(stringToSign))
+}
 
-	signature := base64.StdEncoding.EncodeToString(hashed.Sum(nil))
-	req.SetQueryParam("Signature", signature)
+// poll queries the delivery receipt of each pending phone number with BizId
+//
+//	https://help.aliyun.com/zh/sms/developer-reference/api-dysmsapi-2017-05-25-querysenddetails
+func (a *aliSms) poll(h *History, rs []*Recipient) error {
+	// SendDate is in Beijing time
+	sendDate := time.Unix(h.CreatedAt, 0).In(time.FixedZone("CST", 8*3600)).Format("20060102")
+	for _, r := range rs {
+		req := aliyunRPC(rc.R(), a.conf, "QuerySendDetails", "2017-05-25", map[string]string{
+			"PhoneNumber": r.Recipient,
+			"BizId":       h.VendorId,
+			"SendDate":    sendDate,
+			"PageSize":    "10",
+			"CurrentPage": "1",
+		})
 
-	resp, err := req.Post(aliSmsUrl)
+		resp, err := req.Post(getURL(a.conf, "baseUrl", aliSmsUrl, ""))
+		if err = handleErr("query ali sms send details failed", err, resp, func(dt map[string]any) bool { return dt["Code"] == "OK" }); err != nil {
+			return err
+		}
 
-	RecordResp(msg, err, resp)
+		dt := struct {
+			SmsSendDetailDTOs struct {
+				SmsSendDetailDTO []struct {
+					PhoneNum   string
+					SendStatus int
+					ErrCode    string
+				}
+			}
+		}{}
+		_ = json.Unmarshal(resp.Body(), &dt)
+		if len(dt.SmsSendDetailDTOs.SmsSendDetailDTO) <= 0 {
+			continue
+		}
+		// SendStatus 1 waiting for receipt, 2 failed, 3 delivered
+		switch d := dt.SmsSendDetailDTOs.SmsSendDetailDTO[0]; d.SendStatus {
+		case 2:
+			err = r.update(recipientFailed, d.ErrCode)
+		case 3:
+			err = r.update(recipientDelivered, "")
+		}
+		if err != nil {
+			return err
+		}
+	}
 
-	return handleErr("send to ali sms failed", err, resp, func(dt map[string]any) bool { return dt["Code"] == "OK" })
+	return nil
 }
 
 func (a *aliSms) getConf() map[string]string {
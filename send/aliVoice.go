@@ -0,0 +1,91 @@
+package send
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+)
+
+const (
+	aliVoiceUrl = "http://dyvmsapi.aliyuncs.com"
+)
+
+var (
+	// aliVoiceExtraKeys are the documented params of SingleCallByTts which could be set per call in extra
+	aliVoiceExtraKeys = []string{"CalledShowNumber", "TtsCode", "TtsParam", "PlayTimes", "Volume", "Speed", "OutId"}
+)
+
+func init() {
+	registered["aliVoice"] = func(conf map[string]string) sender {
+		return &aliVoice{conf: conf}
+	}
+}
+
+type aliVoice struct {
+	conf map[string]string
+}
+
+// send ali voice call, one call is placed for each phone number in tos
+//
+//	https://help.aliyun.com/zh/vms/developer-reference/api-dyvmsapi-2017-05-25-singlecallbytts
+func (a *aliVoice) send(msg *message) error {
+	body := map[string]string{
+		"TtsCode": a.conf["ttsCode"],
+	}
+	for k, v := range map[string]string{
+		"CalledShowNumber": a.conf["calledShowNumber"],
+		"PlayTimes":        a.conf["playTimes"],
+		"Volume":           a.conf["volume"],
+		"Speed":            a.conf["speed"],
+	} {
+		if v != "" {
+			body[k] = v
+		}
+	}
+	if msg.Content != "" {
+		body["TtsParam"] = msg.Content
+	}
+	// per call params like CalledShowNumber and TtsCode in extra override the conf, other keys are ignored
+	extra := lo.PickByKeys(msg.ExtraMap, aliVoiceExtraKeys)
+	body = lo.Assign(body, lo.MapValues(extra, func(v any, _ string) string { return cast.ToString(v) }))
+
+	callIds, errs := make([]string, 0), make([]string, 0)
+	reqs, resps := make([]string, 0), make([]string, 0)
+	// requests and responses of all calls are kept in history
+	defer func() {
+		msg.Req, msg.Resp = strings.Join(reqs, "\n"), strings.Join(resps, "\n")
+	}()
+	for _, to := range msg.Tos {
+		req := aliyunRPC(recordedR(msg), a.conf, "SingleCallByTts", "2017-05-25",
+			lo.Assign(body, map[string]string{"CalledNumber": to}))
+
+		resp, err := req.Post(getURL(a.conf, "baseUrl", aliVoiceUrl, ""))
+
+		RecordResp(msg, err, resp)
+		reqs, resps = append(reqs, msg.Req), append(resps, msg.Resp)
+
+		if err = handleErr("call with ali voice failed", err, resp, func(dt map[string]any) bool { return dt["Code"] == "OK" }); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", to, err))
+			msg.failRecipient(to, err)
+			continue
+		}
+
+		dt := make(map[string]any)
+		_ = json.Unmarshal(resp.Body(), &dt)
+		callIds = append(callIds, cast.ToString(dt["CallId"]))
+	}
+	msg.VendorId = strings.Join(callIds, ",")
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+func (a *aliVoice) getConf() map[string]string {
+	return a.conf
+}
@@ -0,0 +1,62 @@
+package send
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+)
+
+// aliyunRPC returns a POST request of aliyun rpc style api signed with HMAC-SHA1, body will be sent as form data
+//
+//	https://help.aliyun.com/zh/sdk/product-overview/rpc-mechanism
+func aliyunRPC(r *resty.Request, conf map[string]string, action, version string, body map[string]string) *resty.Request {
+	r.SetHeader("Content-Type", "application/x-www-form-urlencoded").
+		SetQueryParams(map[string]string{
+			"Action":           action,
+			"Version":          version,
+			"Format":           "JSON",
+			"AccessKeyId":      conf["accessKey"],
+			"SignatureNonce":   cast.ToString(rand.Int63()),
+			"Timestamp":        time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+			"SignatureMethod":  "HMAC-SHA1",
+			"SignatureVersion": "1.0",
+			"AcceptLanguage":   "zh-CN",
+		}).
+		SetFormData(body)
+	ks := lo.Keys(body)
+	for k := range r.QueryParam {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	encodeParams := make([]string, 0)
+	for _, k := range ks {
+		v, ok := body[k]
+		if !ok {
+			v = r.QueryParam.Get(k)
+		}
+		encodeParams = append(encodeParams, fmt.Sprintf("%s=%s", url.QueryEscape(k), url.QueryEscape(v)))
+	}
+	CanonicalizedQueryString := strings.Join(encodeParams, "&")
+	stringToSign := fmt.Sprintf("%s&%s&%s",
+		"POST",
+		url.QueryEscape("/"),
+		url.QueryEscape(CanonicalizedQueryString),
+	)
+	hashed := hmac.New(sha1.New, []byte(conf["accessSecret"]+"&"))
+	hashed.Write([]byte(stringToSign))
+
+	signature := base64.StdEncoding.EncodeToString(hashed.Sum(nil))
+	r.SetQueryParam("Signature", signature)
+
+	return r
+}
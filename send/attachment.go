@@ -0,0 +1,182 @@
+package send
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/samber/lo"
+
+	"github.com/veops/messenger/global"
+)
+
+const (
+	// maxAttachmentSize is the max size of attachments loaded from url or path, it is the file limit of wechatApp
+	maxAttachmentSize = 20 << 20
+)
+
+var (
+	// attachmentClient neither retries nor records requests since downloads are not part of the message
+	attachmentClient = resty.New().
+		SetTimeout(time.Minute).
+		SetRedirectPolicy(resty.RedirectPolicyFunc(func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return fmt.Errorf("stopped after 10 redirects")
+			}
+			return checkAttachmentURL(req.URL)
+		}))
+)
+
+type attachment struct {
+	Name   string `json:"name" validate:"optional" example:"alert.png"`
+	Base64 string `json:"base64" validate:"optional" example:""`
+	Url    string `json:"url" validate:"optional" example:"https://xxx.com/alert.png"`
+	Path   string `json:"path" validate:"optional" example:""`
+}
+
+// load reads the content of attachment from base64, url or local path, url must be on one of attachmentHosts of app conf,
+// local path must be under one of the directories in attachmentDirs of app conf
+func (a *attachment) load() (name string, bs []byte, err error) {
+	name = a.Name
+	switch {
+	case a.Base64 != "":
+		bs, err = base64.StdEncoding.DecodeString(a.Base64)
+	case a.Url != "":
+		var u *url.URL
+		if bs, u, err = download(a.Url); err == nil {
+			name = lo.Ternary(name != "", name, path.Base(u.Path))
+		}
+	case a.Path != "":
+		var p string
+		if p, err = checkAttachmentPath(a.Path); err == nil {
+			bs, err = readLimited(p)
+			name = lo.Ternary(name != "", name, filepath.Base(a.Path))
+		}
+	default:
+		err = fmt.Errorf("one of base64, url and path of attachment is required")
+	}
+
+	return
+}
+
+// download returns the content of url and the final url after redirects
+func download(rawURL string) (bs []byte, u *url.URL, err error) {
+	if u, err = url.Parse(rawURL); err != nil {
+		return
+	}
+	if err = checkAttachmentURL(u); err != nil {
+		return
+	}
+	resp, err := attachmentClient.R().SetDoNotParseResponse(true).Get(rawURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("download attachment failed, err=%w", err)
+	}
+	body := resp.RawBody()
+	defer body.Close()
+	if resp.StatusCode() != http.StatusOK {
+		return nil, nil, fmt.Errorf("download attachment failed httpcode=%v", resp.StatusCode())
+	}
+	if resp.RawResponse.ContentLength > maxAttachmentSize {
+		return nil, nil, fmt.Errorf("attachment is larger than %d bytes", maxAttachmentSize)
+	}
+	if bs, err = readAllLimited(body); err != nil {
+		return nil, nil, err
+	}
+
+	return bs, resp.RawResponse.Request.URL, nil
+}
+
+// checkAttachmentURL returns error if the host of u is not in attachmentHosts of app conf,
+// hosts are separated by comma, and *.xxx.com matches all subdomains of xxx.com
+func checkAttachmentURL(u *url.URL) error {
+	appConf, err := global.GetAppConf()
+	if err != nil {
+		return err
+	}
+	host := strings.ToLower(u.Hostname())
+	if (u.Scheme == "http" || u.Scheme == "https") && host != "" {
+		for _, h := range strings.Split(appConf["attachmentHosts"], ",") {
+			h = strings.ToLower(strings.TrimSpace(h))
+			if h != "" && (h == host || (strings.HasPrefix(h, "*.") && strings.HasSuffix(host, h[1:]))) {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("attachment url %s is not allowed", u.Redacted())
+}
+
+// checkAttachmentPath returns the path with symlinks resolved if it is under one of attachmentDirs of app conf
+func checkAttachmentPath(p string) (string, error) {
+	appConf, err := global.GetAppConf()
+	if err != nil {
+		return "", err
+	}
+	// symlinks are resolved so that links under attachmentDirs cannot point to other files
+	abs, err := filepath.Abs(p)
+	if err == nil {
+		abs, err = filepath.EvalSymlinks(abs)
+	}
+	if err != nil {
+		return "", err
+	}
+	for _, dir := range strings.Split(appConf["attachmentDirs"], ",") {
+		if dir = strings.TrimSpace(dir); dir == "" {
+			continue
+		}
+		d, err := filepath.Abs(dir)
+		if err == nil {
+			d, err = filepath.EvalSymlinks(d)
+		}
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(d, abs); err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+			return abs, nil
+		}
+	}
+
+	return "", fmt.Errorf("attachment path %s is not allowed", p)
+}
+
+func readLimited(p string) ([]byte, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readAllLimited(f)
+}
+
+// readAllLimited reads r until EOF, it returns error if there are more than maxAttachmentSize bytes
+func readAllLimited(r io.Reader) ([]byte, error) {
+	bs, err := io.ReadAll(io.LimitReader(r, maxAttachmentSize+1))
+	if err == nil && len(bs) > maxAttachmentSize {
+		err = fmt.Errorf("attachment is larger than %d bytes", maxAttachmentSize)
+	}
+	return bs, err
+}
+
+// uploadAttachment loads the first attachment of msg and uploads it with upload, returns the media key of vendor
+func uploadAttachment(msg *message, upload func(name string, bs []byte) (string, error)) (key string, err error) {
+	if len(msg.Attachments) <= 0 {
+		return "", fmt.Errorf("attachments is required by message type %s", msg.MsgType)
+	}
+	name, bs, err := msg.Attachments[0].load()
+	if err != nil {
+		return
+	}
+	if key, err = upload(name, bs); err != nil {
+		return "", fmt.Errorf("upload attachment %s failed, err=%w", name, err)
+	}
+
+	return
+}
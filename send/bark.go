@@ -0,0 +1,87 @@
+package send
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+)
+
+const (
+	barkURL = "https://api.day.app"
+)
+
+func init() {
+	registered["bark"] = func(conf map[string]string) sender {
+		return &bark{conf: conf}
+	}
+}
+
+type bark struct {
+	conf map[string]string
+}
+
+// send bark push, tos are device keys and the key in conf is used if tos is empty
+//
+//	https://bark.day.app/#/tutorial?id=请求参数
+func (b *bark) send(msg *message) error {
+	if msg.Simple {
+		switch msg.MsgType {
+		case simpleText, simpleMarkdown:
+			msg.ContentMap = map[string]any{
+				"title": msg.Title,
+				lo.Ternary(msg.MsgType == simpleMarkdown, "markdown", "body"): msg.Content,
+			}
+		default:
+			return fmt.Errorf("sender type %s does not support simple type %s", b.conf["type"], msg.MsgType)
+		}
+	}
+
+	body := lo.Assign(msg.ExtraMap, msg.ContentMap)
+	if v, ok := msg.ExtraMap["priority"]; ok {
+		delete(body, "priority")
+		body["level"] = barkLevel(cast.ToInt(v))
+	}
+
+	keys := lo.Ternary(len(msg.Tos) > 0, msg.Tos, []string{b.conf["key"]})
+	errs := make([]string, 0)
+	for _, key := range keys {
+		resp, err := recordedR(msg).
+			SetBody(lo.Assign(body, map[string]any{
+				"device_key": key,
+			})).
+			Post(getURL(b.conf, "url", barkURL, "/push"))
+
+		RecordResp(msg, err, resp)
+
+		if err = handleErr("send to bark failed", err, resp, func(dt map[string]any) bool { return dt["code"] == 200.0 }); err != nil {
+			errs = append(errs, err.Error())
+			msg.failRecipient(key, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+func (b *bark) getConf() map[string]string {
+	return b.conf
+}
+
+// barkLevel maps priority 1-5 like ntfy to bark interruption level
+func barkLevel(priority int) string {
+	switch {
+	case priority >= 5:
+		return "critical"
+	case priority == 4:
+		return "timeSensitive"
+	case priority > 0 && priority <= 2:
+		return "passive"
+	default:
+		return "active"
+	}
+}
@@ -0,0 +1,185 @@
+package send
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/samber/lo"
+)
+
+const (
+	maxBatchSize = 1000
+)
+
+// batchSender is implemented by senders which could send a group of messages with vendor batch apis,
+// the result of each message is set in its Err, Req, Resp, VendorId and Recipients
+type batchSender interface {
+	sender
+	sendBatch(msgs []*message)
+}
+
+type batchMessageReq struct {
+	Messages []*message   `json:"messages" validate:"optional"`
+	Template *message     `json:"template" validate:"optional"`
+	Items    []*batchItem `json:"items" validate:"optional"`
+}
+
+// batchItem is a message rendered from the template with vars, title, content and extra of template are go text/template
+type batchItem struct {
+	Tos  []string       `json:"tos" validate:"optional" example:"1390000****"`
+	Vars map[string]any `json:"vars" validate:"optional"`
+}
+
+type batchResult struct {
+	Index int    `json:"index"`
+	Id    string `json:"id"`
+	Err   string `json:"err"`
+}
+
+// BatchPushMessage
+//
+//	@Tags			send
+//	@Description	send messages in batch, messages are validated at first and the valid ones are sent asynchronously,
+//	@Description	messages could be a list of messages, or a template with a list of tos and vars to render it
+//	@Accept			json
+//	@Produce		json
+//	@Param			body	body		batchMessageReq		true	" "
+//	@Success		200		{object}	map[string]any		"a map with msg info and results of each message, eg. {msg:ok,results:[{index:0,id:xxx,err:}]}"
+//	@Router			/v1/messages/batch [POST]
+func BatchPushMessage(ctx *gin.Context) {
+	r := &batchMessageReq{}
+	if err := ctx.ShouldBindBodyWith(r, binding.JSON); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	msgs, errs := r.Messages, make([]error, len(r.Messages))
+	if r.Template != nil {
+		for _, item := range r.Items {
+			m, err := renderBatchItem(r.Template, item)
+			msgs, errs = append(msgs, m), append(errs, err)
+		}
+	}
+	if len(msgs) <= 0 || len(msgs) > maxBatchSize {
+		ctx.AbortWithError(http.StatusBadRequest, fmt.Errorf("count of messages must be between 1 and %d", maxBatchSize))
+		return
+	}
+
+	now, tenant := time.Now().Unix(), tenantOf(ctx)
+	results, valid := make([]*batchResult, len(msgs)), make([]*message, 0)
+	for i, m := range msgs {
+		if m != nil {
+			m.Tenant = tenant
+		}
+		if errs[i] == nil {
+			errs[i] = validateMessage(m)
+		}
+		results[i] = &batchResult{Index: i}
+		if errs[i] != nil {
+			results[i].Err = errs[i].Error()
+			continue
+		}
+		m.ReceivedAt, m.Sync = now, false
+		m.Id = lo.Ternary(m.Id != "", m.Id, newMessageId())
+		m.Ats, m.AtMobiles = lo.Uniq(m.Ats), lo.Uniq(m.AtMobiles)
+		results[i].Id = m.Id
+		valid = append(valid, m)
+	}
+
+	for name, ms := range lo.GroupBy(valid, func(m *message) string { return m.Sender }) {
+		s, _ := getSender(tenant, name)
+		bs, ok := s.(batchSender)
+		if !ok || bs == nil || len(ms) <= 1 {
+			lo.ForEach(ms, func(m *message, _ int) { enqueue(m) })
+			continue
+		}
+		lo.ForEach(ms, func(m *message, _ int) { publishEvent(eventQueued, m) })
+		go handleBatch(bs, ms)
+	}
+
+	ctx.JSON(http.StatusOK, map[string]any{"results": results})
+}
+
+// validateMessage checks the sender and parses the content and extra of message
+func validateMessage(m *message) error {
+	if m == nil {
+		return fmt.Errorf("message is empty")
+	}
+	if _, ok := getSender(m.Tenant, m.Sender); !ok {
+		return fmt.Errorf("cannot find sender with name %s", m.Sender)
+	}
+	if m.MsgType == "" {
+		return fmt.Errorf("msgtype is required")
+	}
+	return parseMessage(m)
+}
+
+// batchFuncs are the functions of batch templates, json encodes a value so that vars with quotes could be put into json content and extra
+var batchFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		bs, err := json.Marshal(v)
+		return string(bs), err
+	},
+}
+
+// renderBatchItem renders title, content and extra of template with vars of item
+func renderBatchItem(tpl *message, item *batchItem) (m *message, err error) {
+	if item == nil {
+		return nil, fmt.Errorf("item is empty")
+	}
+	m = &message{}
+	*m = *tpl
+	// each item is a message with its own id
+	m.Id, m.Tos = "", item.Tos
+	for _, f := range []*string{&m.Title, &m.Content, &m.Extra} {
+		t, err := template.New("").Option("missingkey=error").Funcs(batchFuncs).Parse(*f)
+		if err != nil {
+			return nil, err
+		}
+		buf := &bytes.Buffer{}
+		if err = t.Execute(buf, item.Vars); err != nil {
+			return nil, err
+		}
+		*f = buf.String()
+	}
+
+	return
+}
+
+func handleBatch(s batchSender, msgs []*message) {
+	defer func() {
+		if r := recover(); r != nil {
+			err := fmt.Errorf("%v", r)
+			log.Println(err)
+			lo.ForEach(msgs, func(m *message, _ int) { m.Err = lo.Ternary(m.Err != nil, m.Err, err) })
+		}
+		lo.ForEach(msgs, func(m *message, _ int) { finishMessage(m, nil) })
+	}()
+
+	s.sendBatch(lo.Filter(msgs, func(m *message, _ int) bool {
+		m.Err = resolveContacts(s, m)
+		return m.Err == nil && !m.suppressed()
+	}))
+}
+
+// chunkByTos splits msgs into chunks whose count of tos is no more than size, a message with more tos is a chunk itself
+func chunkByTos(msgs []*message, size int) [][]*message {
+	chunks, chunk, n := make([][]*message, 0), make([]*message, 0), 0
+	for _, m := range msgs {
+		if len(chunk) > 0 && n+len(m.Tos) > size {
+			chunks, chunk, n = append(chunks, chunk), make([]*message, 0), 0
+		}
+		chunk, n = append(chunk, m), n+len(m.Tos)
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks
+}
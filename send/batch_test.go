@@ -0,0 +1,53 @@
+package send
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRenderBatchItem(t *testing.T) {
+	tpl := &message{Id: "tpl", Sender: "sms", Title: "{{ .name }}", Content: `{"name":{{ json .name }},"code":"{{ .code }}"}`}
+	m, err := renderBatchItem(tpl, &batchItem{Tos: []string{"1"}, Vars: map[string]any{"name": `a"b`, "code": 1234}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Id != "" || tpl.Id != "tpl" {
+		t.Errorf("id of item = %s, id of template = %s", m.Id, tpl.Id)
+	}
+	content := make(map[string]string)
+	if err = json.Unmarshal([]byte(m.Content), &content); err != nil || content["name"] != `a"b` || content["code"] != "1234" {
+		t.Errorf("content = %s, err = %v", m.Content, err)
+	}
+	if m.Title != `a"b` || len(m.Tos) != 1 || len(tpl.Tos) != 0 {
+		t.Errorf("message = %+v", m)
+	}
+	if _, err = renderBatchItem(tpl, &batchItem{Vars: map[string]any{"name": "a"}}); err == nil {
+		t.Errorf("item with missing var should fail")
+	}
+}
+
+func TestAliSmsSendBatch(t *testing.T) {
+	params := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params = r.PostFormValue("TemplateParamJson")
+		w.Write([]byte(`{"Code":"OK","BizId":"1"}`))
+	}))
+	defer srv.Close()
+
+	a := &aliSms{conf: map[string]string{"baseUrl": srv.URL, "signName": "sign", "templateCode": "SMS_1"}}
+	msgs := []*message{
+		{Tos: []string{"1"}, Content: `{"code":"1"}`},
+		{Tos: []string{"2"}, Content: `code is 2`, Simple: true},
+		{Tos: []string{"3"}, Content: `{"code":"3"}`},
+	}
+	a.sendBatch(msgs)
+
+	if params != `[{"code":"1"},{"code":"3"}]` {
+		t.Errorf("TemplateParamJson = %s", params)
+	}
+	if msgs[0].Err != nil || msgs[2].Err != nil || msgs[0].VendorId != "1" || msgs[1].Err == nil {
+		t.Errorf("errs = %v %v %v", msgs[0].Err, msgs[1].Err, msgs[2].Err)
+	}
+}
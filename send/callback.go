@@ -0,0 +1,299 @@
+package send
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+	"golang.org/x/sync/errgroup"
+	"gorm.io/gorm"
+
+	"github.com/veops/messenger/global"
+)
+
+type callbackHandler interface {
+	sender
+	// callback verifies and decrypts the callback request, returns the event and the vendor message key of it,
+	// the event is nil if the request is answered already, eg. url verification
+	callback(ctx *gin.Context) (event map[string]any, key string, err error)
+}
+
+type Callback struct {
+	Id        int    `gorm:"column:id" json:"id"`
+	HistoryId int    `gorm:"column:history_id;index" json:"history_id"`
+	Tenant    string `gorm:"column:tenant;index;default:''" json:"tenant"`
+	Sender    string `gorm:"column:sender" json:"sender"`
+	VendorId  string `gorm:"column:vendor_id" json:"vendor_id"`
+	Event     string `gorm:"column:event" json:"event"`
+	Err       string `gorm:"column:err" json:"err"`
+	Status    bool   `gorm:"column:status" json:"status"`
+	CreatedAt int64  `gorm:"column:created_at" json:"created_at"`
+}
+
+func (Callback) TableName() string {
+	return "callback"
+}
+
+// ReceiveCallback
+//
+//	@Tags			callback
+//	@Description	receive interactive callbacks from feishuApp, dingdingApp and wechatApp, the request is verified with the vendor signature,
+//	@Description	then it is recorded against the original message and forwarded to callbackUrl in sender conf
+//	@Param			sender	path	string	true	"sender name"
+//	@Param			tenant	query	string	false	"tenant name of the sender, it is empty for the default tenant"
+//	@Success		200
+//	@Router			/v1/callback/{sender} [POST]
+func ReceiveCallback(ctx *gin.Context) {
+	name, tenant := ctx.Param("sender"), ctx.Query("tenant")
+	s, ok := getSender(tenant, name)
+	if !ok {
+		ctx.String(http.StatusNotFound, "cannot find sender with name %s", name)
+		return
+	}
+	ch, ok := s.(callbackHandler)
+	if !ok || ch == nil {
+		ctx.String(http.StatusBadRequest, "sender with name %s and type %s does not support callback", name, s.getConf()["type"])
+		return
+	}
+
+	event, key, err := ch.callback(ctx)
+	if err != nil {
+		log.Printf("handle callback of sender %s failed, err=%v", name, err)
+		ctx.String(http.StatusUnauthorized, err.Error())
+		return
+	}
+	if event == nil {
+		return
+	}
+
+	bs, _ := json.Marshal(event)
+	cb := &Callback{
+		HistoryId: findHistoryId(tenant, name, key),
+		Tenant:    tenant,
+		Sender:    name,
+		VendorId:  key,
+		Event:     string(bs),
+		CreatedAt: time.Now().Unix(),
+	}
+	if err = db.Create(cb).Error; err != nil {
+		log.Printf("add callback failed, err=%v", err)
+	}
+	go forwardCallback(s, cb, event)
+
+	if !ctx.Writer.Written() {
+		ctx.Status(http.StatusOK)
+	}
+}
+
+// QueryCallback
+//
+//	@Tags			callback
+//	@Description	query callbacks of the authenticated tenant
+//	@Param			page_index	query		int		true	"page_index"
+//	@Param			page_size	query		int		true	"page_size"
+//	@Param			history_id	query		int		false	"history id of the original message"
+//	@Param			sender		query		string	false	"sender name"
+//	@Success		200			{object}	map[string]any
+//	@Router			/v1/callbacks [GET]
+func QueryCallback(ctx *gin.Context) {
+	pageIndex, pageSize := cast.ToInt(ctx.Query("page_index")), cast.ToInt(ctx.Query("page_size"))
+	q := db.Model(&Callback{}).Where("tenant = ?", tenantOf(ctx)).Offset((pageIndex - 1) * pageSize).Limit(pageSize).Order("id DESC")
+	for _, k := range []string{"history_id", "sender"} {
+		if v, ok := ctx.GetQuery(k); ok {
+			q = q.Where(fmt.Sprintf("%s = ?", k), v)
+		}
+	}
+	count := int64(0)
+	callbacks := make([]*Callback, 0)
+	cfg := &gorm.Session{}
+	eg := errgroup.Group{}
+	eg.Go(func() error {
+		return q.Session(cfg).Count(&count).Error
+	})
+	eg.Go(func() error {
+		return q.Session(cfg).Find(&callbacks).Error
+	})
+
+	if err := eg.Wait(); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, map[string]any{
+		"count": count,
+		"list":  callbacks,
+	})
+}
+
+// findHistoryId returns the id of the latest history sent by sender of tenant whose vendor id is key, or one of whose comma separated vendor ids is key,
+// or whose content or extra has the string value key, ie. message id returned by vendor, or the task id and out track id of cards set by caller
+func findHistoryId(tenant, sender, key string) int {
+	if key == "" {
+		return 0
+	}
+	h := &History{}
+	// instr matches the exact key, LIKE would match wildcards in key and ignore case
+	db.Model(&History{}).Select("id").
+		Where("tenant = ? AND JSON_EXTRACT(`message`,'$.sender') = ?", tenant, sender).
+		// content and extra are json strings in message, so quotes around their values are escaped
+		Where("instr(',' || vendor_id || ',', ?) > 0 OR instr(message, ?) > 0", ","+key+",", `\"`+key+`\"`).
+		Order("id DESC").Limit(1).Find(h)
+	return h.Id
+}
+
+// forwardCallback posts the callback to callbackUrl of sender, the body is signed with callbackSecret of sender
+// or the secret of sign auth of its tenant in the same way as status webhooks
+func forwardCallback(s sender, cb *Callback, event map[string]any) {
+	url := s.getConf()["callbackUrl"]
+	if url == "" {
+		return
+	}
+	body := map[string]any{
+		"sender":     cb.Sender,
+		"type":       s.getConf()["type"],
+		"history_id": cb.HistoryId,
+		"vendor_id":  cb.VendorId,
+		"event":      event,
+	}
+	r := statusClient.R().SetBody(body)
+	signRequest(r, lo.Ternary(s.getConf()["callbackSecret"] != "", s.getConf()["callbackSecret"], signSecret(cb.Tenant)), global.SignValues(body))
+	resp, err := r.Post(url)
+	updates := map[string]any{"status": true, "err": ""}
+	if err = handle2xxErr("forward callback failed", err, resp, func(dt map[string]any) bool { return true }); err != nil {
+		updates = map[string]any{"status": false, "err": err.Error()}
+	}
+	if err = db.Model(cb).Updates(updates).Error; err != nil {
+		log.Printf("update callback failed, err=%v", err)
+	}
+}
+
+// dig returns the value of dot separated path in nested maps
+func dig(m map[string]any, path string) string {
+	ks := strings.Split(path, ".")
+	for _, k := range ks[:len(ks)-1] {
+		m = cast.ToStringMap(m[k])
+	}
+	return cast.ToString(m[ks[len(ks)-1]])
+}
+
+// xmlToMap converts a flat xml document into map, ie. <xml><A>a</A><B>b</B></xml> to {A:a,B:b}
+func xmlToMap(bs []byte) (map[string]any, error) {
+	m := make(map[string]any)
+	d := xml.NewDecoder(bytes.NewReader(bs))
+	depth, key, buf := 0, "", &strings.Builder{}
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			return m, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch v := t.(type) {
+		case xml.StartElement:
+			if depth++; depth == 2 {
+				key = v.Name.Local
+				buf.Reset()
+			}
+		case xml.CharData:
+			if depth >= 2 {
+				buf.Write(v)
+			}
+		case xml.EndElement:
+			if depth--; depth == 1 {
+				m[key] = strings.TrimSpace(buf.String())
+			}
+		}
+	}
+}
+
+// wxSignature is the sha1 of sorted and concatenated strings, it is used by callbacks of wechat and dingding
+//
+//	https://developer.work.weixin.qq.com/document/path/91116
+func wxSignature(ss ...string) string {
+	sort.Strings(ss)
+	h := sha1.Sum([]byte(strings.Join(ss, "")))
+	return hex.EncodeToString(h[:])
+}
+
+// wxDecrypt decrypts the callback message of wechat and dingding, the plaintext is random(16) + len(4) + msg + receiveId
+func wxDecrypt(aesKey, encrypted string) (msg []byte, receiveId string, err error) {
+	key, err := base64.StdEncoding.DecodeString(aesKey + "=")
+	if err != nil || len(key) != 32 {
+		return nil, "", fmt.Errorf("invalid aes key, err=%v", err)
+	}
+	bs, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return
+	}
+	if bs, err = aesCBCDecrypt(key, key[:aes.BlockSize], bs); err != nil {
+		return
+	}
+	if len(bs) < 20 {
+		return nil, "", fmt.Errorf("invalid plaintext length %d", len(bs))
+	}
+	n := int(binary.BigEndian.Uint32(bs[16:20]))
+	if 20+n > len(bs) {
+		return nil, "", fmt.Errorf("invalid message length %d", n)
+	}
+
+	return bs[20 : 20+n], string(bs[20+n:]), nil
+}
+
+// wxEncrypt is the reverse of wxDecrypt, padding is pkcs7 with block size 32
+func wxEncrypt(aesKey string, msg []byte, receiveId string) (string, error) {
+	key, err := base64.StdEncoding.DecodeString(aesKey + "=")
+	if err != nil || len(key) != 32 {
+		return "", fmt.Errorf("invalid aes key, err=%v", err)
+	}
+	random := make([]byte, 16)
+	_, _ = rand.Read(random)
+	n := make([]byte, 4)
+	binary.BigEndian.PutUint32(n, uint32(len(msg)))
+	bs := bytes.Join([][]byte{random, n, msg, []byte(receiveId)}, nil)
+	pad := 32 - len(bs)%32
+	bs = append(bs, bytes.Repeat([]byte{byte(pad)}, pad)...)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	cipher.NewCBCEncrypter(block, key[:aes.BlockSize]).CryptBlocks(bs, bs)
+
+	return base64.StdEncoding.EncodeToString(bs), nil
+}
+
+// aesCBCDecrypt decrypts with aes cbc mode and removes pkcs7 padding
+func aesCBCDecrypt(key, iv, bs []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(bs) == 0 || len(bs)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("invalid ciphertext length %d", len(bs))
+	}
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(bs, bs)
+	pad := int(bs[len(bs)-1])
+	if pad < 1 || pad > 32 || pad > len(bs) {
+		return nil, fmt.Errorf("invalid padding %d", pad)
+	}
+
+	return bs[:len(bs)-pad], nil
+}
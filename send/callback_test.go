@@ -0,0 +1,150 @@
+package send
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// the samples of wechat work callbacks
+//
+//	https://developer.work.weixin.qq.com/document/path/90968
+const (
+	wxToken   = "QDG6eK"
+	wxAesKey  = "jWmYm7qr5nMoAUwZRjGtBxmz3KA1tkAj3ykkR6q2B2C"
+	wxCorpId  = "wx5823bf96d3bd56c7"
+	wxEchoStr = "P9nAzCzyDtyTWESHep1vC5X9xho/qYX3Zpb4yKa9SKld1DsH3Iyt3tP3zNdtp+4RPcs8TgAE7OaBO+FZXvnaqQ=="
+)
+
+func TestWxSignature(t *testing.T) {
+	if got := wxSignature(wxToken, "1409659589", "263014780", wxEchoStr); got != "5c45ff5e21c57e6ad56bac8758b79b1d9ac89fd3" {
+		t.Errorf("wxSignature = %s", got)
+	}
+}
+
+func TestWxDecrypt(t *testing.T) {
+	msg, receiveId, err := wxDecrypt(wxAesKey, wxEchoStr)
+	if err != nil || string(msg) != "1616140317555161061" || receiveId != wxCorpId {
+		t.Errorf("wxDecrypt echostr = %s %s %v", msg, receiveId, err)
+	}
+}
+
+// the sample of dingtalk event subscriptions
+//
+//	https://open.dingtalk.com/document/orgapp/configure-event-subcription
+func TestWxDecryptDingtalk(t *testing.T) {
+	encrypted := "1a3NBxmCFwkCJvfoQ7WhJHB+iX3qHPsc9JbaDznE1i03peOk1LaOQoRz3+nlyGNhwmwJ3vDMG+OzrHMeiZI7gTRWVdUBmfxjZ8Ej23JVYa9VrYeJ5as7XM/ZpulX8NEQis44w53h1qAgnC3PRzM7Zc/D6Ibr0rgUathB6zRHP8PYrfgnNOS9PhSBdHlegK+AGGanfwjXuQ9+0pZcy0w9lQ=="
+	if got := wxSignature("123456", "1445827045067", "nEXhMP4r", encrypted); got != "5a65ceeef9aab2d149439f82dc191dd6c5cbe2c0" {
+		t.Errorf("wxSignature = %s", got)
+	}
+	msg, receiveId, err := wxDecrypt("4g5j64qlyl3zvetqxz5jiocdr586fn2zvjpa8zls3ij", encrypted)
+	if err != nil || receiveId != "suite4xxxxxxxxxxxxxxx" ||
+		string(msg) != `{"EventType":"check_create_suite_url","Random":"LPIdSnlF","TestSuiteKey":"suite4xxxxxxxxxxxxxxx"}` {
+		t.Errorf("wxDecrypt = %s %s %v", msg, receiveId, err)
+	}
+}
+
+func TestWxEncrypt(t *testing.T) {
+	encrypted, err := wxEncrypt(wxAesKey, []byte("success"), wxCorpId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, receiveId, err := wxDecrypt(wxAesKey, encrypted)
+	if err != nil || string(msg) != "success" || receiveId != wxCorpId {
+		t.Errorf("wxDecrypt(wxEncrypt) = %s %s %v", msg, receiveId, err)
+	}
+	if _, _, err = wxDecrypt(wxAesKey[1:], encrypted); err == nil {
+		t.Errorf("wxDecrypt with invalid aes key should fail")
+	}
+}
+
+func TestXmlToMap(t *testing.T) {
+	m, err := xmlToMap([]byte("<xml><MsgType><![CDATA[event]]></MsgType><TaskId> task1 </TaskId></xml>"))
+	if err != nil || m["MsgType"] != "event" || m["TaskId"] != "task1" {
+		t.Errorf("xmlToMap = %v %v", m, err)
+	}
+}
+
+// the sample of feishu encrypted events
+//
+//	https://open.feishu.cn/document/server-docs/event-subscription-guide/event-subscription-configure-/encrypt-key-encryption-configuration-case
+func TestFeishuDecrypt(t *testing.T) {
+	bs, err := feishuDecrypt("test key", "P37w+VZImNgPEO1RBhJ6RtKl7n6zymIbEG1pReEzghk=")
+	if err != nil || string(bs) != "hello world" {
+		t.Errorf("feishuDecrypt = %s %v", bs, err)
+	}
+}
+
+func TestFeishuCallbackVerification(t *testing.T) {
+	ek := "test key"
+	body := fmt.Sprintf(`{"encrypt":"%s"}`, feishuEncrypt(t, ek, `{"schema":"2.0","header":{"event_type":"card.action.trigger"},"event":{"context":{"open_message_id":"om_1"}}}`))
+	for _, c := range []struct {
+		conf map[string]string
+		sig  string
+		err  string
+	}{
+		{map[string]string{}, "", "encryptKey is required"},
+		{map[string]string{"encryptKey": ek}, "", "invalid signature"},
+		{map[string]string{"encryptKey": ek}, "wrong", "invalid signature"},
+		{map[string]string{"encryptKey": ek}, feishuSignature(ek, "1", "n", []byte(body)), ""},
+	} {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/callback/feishu", strings.NewReader(body))
+		ctx.Request.Header.Set("X-Lark-Request-Timestamp", "1")
+		ctx.Request.Header.Set("X-Lark-Request-Nonce", "n")
+		if c.sig != "" {
+			ctx.Request.Header.Set("X-Lark-Signature", c.sig)
+		}
+		_, key, err := (&feishuApp{conf: c.conf}).callback(ctx)
+		if c.err == "" && (err != nil || key != "om_1") {
+			t.Errorf("callback = %s %v, want om_1", key, err)
+		}
+		if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("callback with conf %v and signature %s = %v, want %s", c.conf, c.sig, err, c.err)
+		}
+	}
+}
+
+// feishuEncrypt is the reverse of feishuDecrypt
+func feishuEncrypt(t *testing.T, encryptKey, plaintext string) string {
+	k := sha256.Sum256([]byte(encryptKey))
+	block, err := aes.NewCipher(k[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	pad := aes.BlockSize - len(plaintext)%aes.BlockSize
+	bs := append(make([]byte, aes.BlockSize), []byte(plaintext)...)
+	bs = append(bs, bytes.Repeat([]byte{byte(pad)}, pad)...)
+	cipher.NewCBCEncrypter(block, bs[:aes.BlockSize]).CryptBlocks(bs[aes.BlockSize:], bs[aes.BlockSize:])
+	return base64.StdEncoding.EncodeToString(bs)
+}
+
+func TestFindHistoryId(t *testing.T) {
+	tenant := "test-find-history-id"
+	hs := []*History{
+		{Tenant: tenant, Message: `{"sender":"s"}`, VendorId: "om_1,om_2"},
+		{Tenant: tenant, Message: `{"sender":"s","content":"{\"task_id\":\"task_1\"}"}`, VendorId: "x"},
+	}
+	if err := db.Create(hs).Error; err != nil {
+		t.Fatal(err)
+	}
+	defer db.Where("tenant = ?", tenant).Delete(&History{})
+
+	for key, want := range map[string]int{"om_1": hs[0].Id, "om_2": hs[0].Id, "om_": 0, "om%": 0, "OM_1": 0, "task_1": hs[1].Id, "task": 0, "x": hs[1].Id} {
+		if got := findHistoryId(tenant, "s", key); got != want {
+			t.Errorf("findHistoryId(%s) = %d, want %d", key, got, want)
+		}
+	}
+	if got := findHistoryId("other", "s", "om_1"); got != 0 {
+		t.Errorf("findHistoryId of other tenant = %d", got)
+	}
+}
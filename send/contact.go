@@ -0,0 +1,407 @@
+package send
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+	"golang.org/x/sync/errgroup"
+	"gorm.io/gorm"
+)
+
+const (
+	contactPrefix = "contact:"
+	groupPrefix   = "group:"
+)
+
+// Contact is a person with ids of different senders, identities are keyed by sender name or sender type
+type Contact struct {
+	Id         int               `gorm:"column:id" json:"id"`
+	Tenant     string            `gorm:"column:tenant;uniqueIndex:idx_contact_tenant_name;default:''" json:"-"`
+	Name       string            `gorm:"column:name;uniqueIndex:idx_contact_tenant_name" json:"name" validate:"required" example:"alice"`
+	Email      string            `gorm:"column:email" json:"email" validate:"optional" example:"alice@xxx.com"`
+	Phone      string            `gorm:"column:phone" json:"phone" validate:"optional" example:"1390000****"`
+	Identities map[string]string `gorm:"column:identities;serializer:json" json:"identities" validate:"optional"`
+}
+
+func (Contact) TableName() string {
+	return "contact"
+}
+
+// Group is a list of contact names
+type Group struct {
+	Id      int      `gorm:"column:id" json:"id"`
+	Tenant  string   `gorm:"column:tenant;uniqueIndex:idx_group_tenant_name;default:''" json:"-"`
+	Name    string   `gorm:"column:name;uniqueIndex:idx_group_tenant_name" json:"name" validate:"required" example:"sre"`
+	Members []string `gorm:"column:members;serializer:json" json:"members" validate:"optional" example:"alice"`
+}
+
+func (Group) TableName() string {
+	return "contact_group"
+}
+
+// identity returns the id of contact for sender s, it is the identity of sender name or sender type,
+// then email for email and phone for sms and voice, otherwise it is queried by phone or email and saved for senders supporting it
+func (c *Contact) identity(s sender) (string, error) {
+	conf := s.getConf()
+	for _, k := range []string{conf["name"], conf["type"]} {
+		if v := c.Identities[k]; v != "" {
+			return v, nil
+		}
+	}
+	switch conf["type"] {
+	case "email":
+		if c.Email != "" {
+			return c.Email, nil
+		}
+	case "aliSms", "tencentSms", "aliVoice":
+		if c.Phone != "" {
+			return c.Phone, nil
+		}
+	}
+	if phones, emails := c.lookupKeys(s); len(phones) > 0 || len(emails) > 0 {
+		uids, err := lookupUIDs(s, phones, emails)
+		if err != nil {
+			return "", fmt.Errorf("query uid of contact %s failed, err=%w", c.Name, err)
+		}
+		uid := lo.Ternary(uids[c.Phone] != "", uids[c.Phone], uids[c.Email])
+		if uid == "" {
+			return "", fmt.Errorf("cannot find uid of contact %s with sender %s", c.Name, conf["name"])
+		}
+		c.Identities = lo.Assign(c.Identities, map[string]string{conf["name"]: uid})
+		if err = db.Model(c).Select("identities").Updates(c).Error; err != nil {
+			log.Printf("save identity of contact %s failed, err=%v", c.Name, err)
+		}
+		return uid, nil
+	}
+
+	return "", fmt.Errorf("contact %s has no identity for sender %s", c.Name, conf["name"])
+}
+
+// lookupKeys returns the phone and email of contact which sender s could query uids by
+func (c *Contact) lookupKeys(s sender) (phones, emails []string) {
+	switch s.(type) {
+	case uidLooker:
+		return lo.Compact([]string{c.Phone}), lo.Compact([]string{c.Email})
+	case senderManager:
+		return lo.Compact([]string{c.Phone}), nil
+	}
+	return nil, nil
+}
+
+// fillIdentities queries the missing identities of contact by phone or email with all senders of its tenant supporting it, failures are ignored
+func (c *Contact) fillIdentities() {
+	for _, s := range name2sender {
+		if s == nil || s.getConf()["tenant"] != c.Tenant {
+			continue
+		}
+		// senders which cannot query by the phone or email of contact are skipped without calling vendors
+		if phones, emails := c.lookupKeys(s); len(phones) > 0 || len(emails) > 0 {
+			_, _ = c.identity(s)
+		}
+	}
+}
+
+// resolveContacts replaces contact:name and group:name in tos, ats and at_mobiles with identities of contacts for sender s,
+// contacts in tos are filtered by their preferences
+func resolveContacts(s sender, msg *message) (err error) {
+	filter := func(c *Contact) bool { return filterByPreference(s, msg, c) }
+	if msg.Tos, err = resolveRefs(s, msg.Tenant, msg.Tos, (*Contact).identity, filter); err != nil {
+		return
+	}
+	if msg.Ats, err = resolveRefs(s, msg.Tenant, msg.Ats, (*Contact).identity, nil); err != nil {
+		return
+	}
+	msg.AtMobiles, err = resolveRefs(s, msg.Tenant, msg.AtMobiles, func(c *Contact, _ sender) (string, error) {
+		return c.Phone, lo.Ternary(c.Phone == "", fmt.Errorf("contact %s has no phone", c.Name), nil)
+	}, nil)
+
+	return
+}
+
+// resolveRefs resolves refs to contacts of tenant with id, contacts are skipped if filter is not nil and returns false
+func resolveRefs(s sender, tenant string, refs []string, id func(*Contact, sender) (string, error), filter func(*Contact) bool) ([]string, error) {
+	isRef := func(ref string) bool {
+		return strings.HasPrefix(ref, contactPrefix) || strings.HasPrefix(ref, groupPrefix)
+	}
+	if !lo.SomeBy(refs, isRef) {
+		return refs, nil
+	}
+	res := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		names := make([]string, 0)
+		switch {
+		case strings.HasPrefix(ref, contactPrefix):
+			names = append(names, strings.TrimPrefix(ref, contactPrefix))
+		case strings.HasPrefix(ref, groupPrefix):
+			g := &Group{}
+			if err := db.Where("tenant = ? AND name = ?", tenant, strings.TrimPrefix(ref, groupPrefix)).First(g).Error; err != nil {
+				return nil, fmt.Errorf("cannot find group %s, err=%w", ref, err)
+			}
+			names = append(names, g.Members...)
+		default:
+			res = append(res, ref)
+			continue
+		}
+		for _, name := range names {
+			c := &Contact{}
+			if err := db.Where("tenant = ? AND name = ?", tenant, name).First(c).Error; err != nil {
+				return nil, fmt.Errorf("cannot find contact %s, err=%w", name, err)
+			}
+			if filter != nil && !filter(c) {
+				continue
+			}
+			v, err := id(c, s)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, v)
+		}
+	}
+
+	return lo.Uniq(res), nil
+}
+
+// QueryContact
+//
+//	@Tags			contact
+//	@Description	query contacts
+//	@Param			page_index	query		int		true	"page_index"
+//	@Param			page_size	query		int		true	"page_size"
+//	@Param			name		query		string	false	"contact name, fuzzy matching"
+//	@Success		200			{object}	map[string]any
+//	@Router			/v1/contacts [GET]
+func QueryContact(ctx *gin.Context) {
+	contacts := make([]*Contact, 0)
+	queryRows(ctx, db.Model(&Contact{}), &contacts)
+}
+
+// AddContact
+//
+//	@Tags			contact
+//	@Description	add a contact, identities of senders supporting to query uid by phone are filled automatically
+//	@Accept			json
+//	@Produce		json
+//	@Param			body	body		Contact				true	" "
+//	@Success		200		{object}	map[string]any		"a map with msg info and the contact"
+//	@Router			/v1/contacts [POST]
+func AddContact(ctx *gin.Context) {
+	c := &Contact{}
+	if err := ctx.ShouldBindBodyWith(c, binding.JSON); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	c.Id, c.Tenant = 0, tenantOf(ctx)
+	if err := db.Create(c).Error; err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	c.fillIdentities()
+
+	ctx.JSON(http.StatusOK, map[string]any{"contact": c})
+}
+
+// UpdateContact
+//
+//	@Tags			contact
+//	@Description	update a contact, identities are replaced by the ones in body
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int					true	"contact id"
+//	@Param			body	body		Contact				true	" "
+//	@Success		200		{object}	map[string]any		"a map with msg info and the contact"
+//	@Router			/v1/contacts/{id} [PUT]
+func UpdateContact(ctx *gin.Context) {
+	c := &Contact{}
+	if err := ctx.ShouldBindBodyWith(c, binding.JSON); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	c.Id, c.Tenant = cast.ToInt(ctx.Param("id")), tenantOf(ctx)
+	if err := updateRow(c.Tenant, c); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	c.fillIdentities()
+
+	ctx.JSON(http.StatusOK, map[string]any{"contact": c})
+}
+
+// DeleteContact
+//
+//	@Tags			contact
+//	@Description	delete a contact, it is removed from its groups and its preference is deleted too
+//	@Param			id	path		int					true	"contact id"
+//	@Success		200	{object}	map[string]string	"a map with msg info, eg. {msg:ok}"
+//	@Router			/v1/contacts/{id} [DELETE]
+func DeleteContact(ctx *gin.Context) {
+	tenant := tenantOf(ctx)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		c := &Contact{}
+		if err := tx.Where("tenant = ? AND id = ?", tenant, cast.ToInt(ctx.Param("id"))).Limit(1).Find(c).Error; err != nil || c.Id == 0 {
+			return err
+		}
+		if err := tx.Delete(c).Error; err != nil {
+			return err
+		}
+		// sending to a group fails if any of its members cannot be found
+		groups := make([]*Group, 0)
+		if err := tx.Where("tenant = ?", tenant).Find(&groups).Error; err != nil {
+			return err
+		}
+		for _, g := range lo.Filter(groups, func(g *Group, _ int) bool { return lo.Contains(g.Members, c.Name) }) {
+			g.Members = lo.Without(g.Members, c.Name)
+			if err := tx.Model(g).Select("members").Updates(g).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Where("tenant = ? AND contact = ?", tenant, c.Name).Delete(&Preference{}).Error
+	})
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, map[string]any{})
+}
+
+// QueryGroup
+//
+//	@Tags			contact
+//	@Description	query groups of contacts
+//	@Param			page_index	query		int		true	"page_index"
+//	@Param			page_size	query		int		true	"page_size"
+//	@Param			name		query		string	false	"group name, fuzzy matching"
+//	@Success		200			{object}	map[string]any
+//	@Router			/v1/groups [GET]
+func QueryGroup(ctx *gin.Context) {
+	groups := make([]*Group, 0)
+	queryRows(ctx, db.Model(&Group{}), &groups)
+}
+
+// AddGroup
+//
+//	@Tags			contact
+//	@Description	add a group of contacts, members are contact names
+//	@Accept			json
+//	@Produce		json
+//	@Param			body	body		Group				true	" "
+//	@Success		200		{object}	map[string]any		"a map with msg info and the group"
+//	@Router			/v1/groups [POST]
+func AddGroup(ctx *gin.Context) {
+	g := &Group{}
+	if err := ctx.ShouldBindBodyWith(g, binding.JSON); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	g.Id, g.Tenant = 0, tenantOf(ctx)
+	if err := checkMembers(g); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	if err := db.Create(g).Error; err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, map[string]any{"group": g})
+}
+
+// UpdateGroup
+//
+//	@Tags			contact
+//	@Description	update a group of contacts
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int					true	"group id"
+//	@Param			body	body		Group				true	" "
+//	@Success		200		{object}	map[string]any		"a map with msg info and the group"
+//	@Router			/v1/groups/{id} [PUT]
+func UpdateGroup(ctx *gin.Context) {
+	g := &Group{}
+	if err := ctx.ShouldBindBodyWith(g, binding.JSON); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	g.Id, g.Tenant = cast.ToInt(ctx.Param("id")), tenantOf(ctx)
+	if err := checkMembers(g); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	if err := updateRow(g.Tenant, g); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, map[string]any{"group": g})
+}
+
+// DeleteGroup
+//
+//	@Tags			contact
+//	@Description	delete a group of contacts, the contacts are kept
+//	@Param			id	path		int					true	"group id"
+//	@Success		200	{object}	map[string]string	"a map with msg info, eg. {msg:ok}"
+//	@Router			/v1/groups/{id} [DELETE]
+func DeleteGroup(ctx *gin.Context) {
+	if err := db.Where("tenant = ?", tenantOf(ctx)).Delete(&Group{}, cast.ToInt(ctx.Param("id"))).Error; err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, map[string]any{})
+}
+
+// checkMembers returns error if any member of group is not a contact of its tenant
+func checkMembers(g *Group) error {
+	g.Members = lo.Uniq(g.Members)
+	names := make([]string, 0)
+	if err := db.Model(&Contact{}).Where("tenant = ? AND name IN ?", g.Tenant, g.Members).Pluck("name", &names).Error; err != nil {
+		return err
+	}
+	if missing, _ := lo.Difference(g.Members, names); len(missing) > 0 {
+		return fmt.Errorf("cannot find contacts %s", strings.Join(missing, ","))
+	}
+	return nil
+}
+
+// updateRow updates all fields of row with its id and tenant, it returns error if the row does not exist
+func updateRow(tenant string, row any) error {
+	tx := db.Model(row).Where("tenant = ?", tenant).Select("*").Updates(row)
+	if tx.Error == nil && tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return tx.Error
+}
+
+// queryRows responds paged rows of the authenticated tenant filtered by name
+func queryRows(ctx *gin.Context, q *gorm.DB, rows any) {
+	pageIndex, pageSize := cast.ToInt(ctx.Query("page_index")), cast.ToInt(ctx.Query("page_size"))
+	q = q.Where("tenant = ?", tenantOf(ctx))
+	if name := ctx.Query("name"); name != "" {
+		q = q.Where("name LIKE ?", fmt.Sprintf("%%%s%%", name))
+	}
+	q = q.Offset((pageIndex - 1) * pageSize).Limit(pageSize).Order("id DESC")
+	count := int64(0)
+	cfg := &gorm.Session{}
+	eg := errgroup.Group{}
+	eg.Go(func() error {
+		return q.Session(cfg).Count(&count).Error
+	})
+	eg.Go(func() error {
+		return q.Session(cfg).Find(rows).Error
+	})
+
+	if err := eg.Wait(); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, map[string]any{
+		"count": count,
+		"list":  rows,
+	})
+}
@@ -0,0 +1,80 @@
+package send
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+
+	"github.com/veops/messenger/global"
+)
+
+func TestContactLookupKeys(t *testing.T) {
+	for _, c := range []struct {
+		name           string
+		s              sender
+		contact        *Contact
+		phones, emails []string
+	}{
+		{"looker with phone and email", &feishuApp{}, &Contact{Phone: "13800000000", Email: "a@b.com"}, []string{"13800000000"}, []string{"a@b.com"}},
+		{"looker with email", &feishuApp{}, &Contact{Email: "a@b.com"}, []string{}, []string{"a@b.com"}},
+		{"manager with phone", &wechatApp{}, &Contact{Phone: "13800000000", Email: "a@b.com"}, []string{"13800000000"}, nil},
+		{"manager with email", &wechatApp{}, &Contact{Email: "a@b.com"}, []string{}, nil},
+		{"other sender", &email{}, &Contact{Phone: "13800000000", Email: "a@b.com"}, nil, nil},
+	} {
+		phones, emails := c.contact.lookupKeys(c.s)
+		if !reflect.DeepEqual(phones, c.phones) || !reflect.DeepEqual(emails, c.emails) {
+			t.Errorf("%s: lookupKeys = %v %v, want %v %v", c.name, phones, emails, c.phones, c.emails)
+		}
+	}
+}
+
+func TestAddWarn(t *testing.T) {
+	m := &message{}
+	m.addWarn("")
+	m.addWarn("cannot find uids of at_mobiles 1")
+	m.addWarn("invaliduser=a")
+	if want := "cannot find uids of at_mobiles 1; invaliduser=a"; m.Warn != want {
+		t.Errorf("warn = %q, want %q", m.Warn, want)
+	}
+}
+
+func TestDeleteContactOfGroup(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tenant := "delete-contact"
+	alice := &Contact{Tenant: tenant, Name: "alice", Email: "alice@xxx.com"}
+	bob := &Contact{Tenant: tenant, Name: "bob", Email: "bob@xxx.com"}
+	if err := db.Create([]*Contact{alice, bob}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&Group{Tenant: tenant, Name: "sre", Members: []string{"alice", "bob"}}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&Preference{Tenant: tenant, Contact: "alice", MinSeverity: "error"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = httptest.NewRequest(http.MethodDelete, "/v1/contacts/"+cast.ToString(alice.Id), nil)
+	ctx.Params = gin.Params{{Key: "id", Value: cast.ToString(alice.Id)}}
+	ctx.Set(global.TenantKey, tenant)
+	DeleteContact(ctx)
+	if w.Code != http.StatusOK {
+		t.Fatalf("delete contact, code = %d", w.Code)
+	}
+
+	msg := &message{Tenant: tenant, Tos: []string{groupPrefix + "sre"}}
+	if err := resolveContacts(&email{conf: map[string]string{"name": "mail", "type": "email"}}, msg); err != nil {
+		t.Fatalf("send to group after deleting its member, err = %v", err)
+	}
+	if !reflect.DeepEqual(msg.Tos, []string{"bob@xxx.com"}) {
+		t.Errorf("tos = %v", msg.Tos)
+	}
+	if n := int64(0); db.Model(&Preference{}).Where("tenant = ? AND contact = ?", tenant, "alice").Count(&n).Error != nil || n != 0 {
+		t.Errorf("preference of deleted contact is kept")
+	}
+}
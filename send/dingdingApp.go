@@ -1,20 +1,42 @@
 package send
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/go-resty/resty/v2"
 	"github.com/samber/lo"
 	"github.com/spf13/cast"
 )
 
 const (
-	dingdingTokenURL  = "https://api.dingtalk.com/v1.0/oauth2/accessToken"
-	dingdingSendURL   = "https://api.dingtalk.com/v1.0/robot/oToMessages/batchSend"
-	dingdingGetUIDURL = "https://oapi.dingtalk.com/topapi/v2/user/getbymobile"
+	dingdingBaseURL          = "https://api.dingtalk.com"
+	dingdingOapiBaseURL      = "https://oapi.dingtalk.com"
+	dingdingTokenPath        = "/v1.0/oauth2/accessToken"
+	dingdingSendPath         = "/v1.0/robot/oToMessages/batchSend"
+	dingdingGroupSendPath    = "/v1.0/robot/groupMessages/send"
+	dingdingNotifyPath       = "/topapi/message/corpconversation/asyncsend_v2"
+	dingdingGetUIDPath       = "/topapi/v2/user/getbymobile"
+	dingdingUploadPath       = "/media/upload"
+	dingdingRecallPath       = "/v1.0/robot/otoMessages/batchRecall"
+	dingdingGroupRecallPath  = "/v1.0/robot/groupMessages/recall"
+	dingdingNotifyRecallPath = "/topapi/message/corpconversation/recall"
+
+	dingdingOto    = "oto"
+	dingdingGroup  = "group"
+	dingdingNotify = "notify"
+
+	dingdingImage = "sampleImageMsg"
+	dingdingFile  = "sampleFile"
 )
 
 func init() {
@@ -30,14 +52,23 @@ type dingdingApp struct {
 	tokenExpireAt time.Time
 }
 
-// send dingtalk app message
+// send dingtalk app message, mode in extra or conf decides how the message is sent
 //
-//	https://open.dingtalk.com/document/orgapp/chatbots-send-one-on-one-chat-messages-in-batches
+//	oto(default): robot one-on-one chat messages, tos are user ids
+//	group: robot group chat messages, tos are open conversation ids
+//	notify: work notifications, tos are user ids, or department ids with prefix party:, @all for all users
 func (d *dingdingApp) send(msg *message) (err error) {
 	if err = d.checkToken(); err != nil {
 		return
 	}
 
+	mode := lo.Ternary(cast.ToString(msg.ExtraMap["mode"]) != "", cast.ToString(msg.ExtraMap["mode"]), d.conf["mode"])
+	extra := lo.OmitByKeys(msg.ExtraMap, []string{"mode"})
+
+	if mode == dingdingNotify {
+		return d.notify(msg, extra)
+	}
+
 	if msg.Simple {
 		switch msg.MsgType {
 		case simpleText:
@@ -51,33 +82,376 @@ func (d *dingdingApp) send(msg *message) (err error) {
 				"title": msg.Title,
 				"text":  msg.Content,
 			}
+		case simpleImage:
+			msg.MsgType = dingdingImage
+			msg.ContentMap = make(map[string]any)
+		case simpleFile:
+			msg.MsgType = dingdingFile
+			msg.ContentMap = make(map[string]any)
 		default:
 			return fmt.Errorf("sender type %s does not support simple type %s", d.conf["type"], msg.MsgType)
 		}
 	}
+
+	if len(msg.Attachments) > 0 {
+		if err = d.attach(msg); err != nil {
+			return
+		}
+	}
+
+	switch mode {
+	case "", dingdingOto:
+		return d.oto(msg, extra)
+	case dingdingGroup:
+		return d.group(msg, extra)
+	default:
+		return fmt.Errorf("sender type %s does not support mode %s", d.conf["type"], mode)
+	}
+}
+
+// oto
+//
+//	https://open.dingtalk.com/document/orgapp/chatbots-send-one-on-one-chat-messages-in-batches
+func (d *dingdingApp) oto(msg *message, extra map[string]any) (err error) {
+	type res struct {
+		ProcessQueryKey           string   `json:"processQueryKey"`
+		InvalidStaffIdList        []string `json:"invalidStaffIdList"`
+		FlowControlledStaffIdList []string `json:"flowControlledStaffIdList"`
+	}
+	r := &res{}
+
 	bs, _ := json.Marshal(msg.ContentMap)
-	resp, err := rc.SetPreRequestHook(RecordHttpReq(msg)).R().
+	resp, err := recordedR(msg).
 		SetHeader("x-acs-dingtalk-access-token", d.token).
-		SetBody(lo.Assign(msg.ExtraMap, map[string]any{
+		SetBody(lo.Assign(extra, map[string]any{
 			"robotCode": d.conf["robotCode"],
 			"userIds":   msg.Tos,
 			"msgKey":    msg.MsgType,
 			"msgParam":  string(bs),
 		})).
-		Post(dingdingSendURL)
+		SetResult(r).
+		Post(d.url(dingdingSendPath))
 
 	RecordResp(msg, err, resp)
 
-	return handleErr("send to dingding app failed", err, resp, func(dt map[string]any) bool {
+	if err = handleErr("send to dingding app failed", err, resp, func(dt map[string]any) bool {
 		_, ok := dt["processQueryKey"]
 		return ok
-	})
+	}); err != nil {
+		return
+	}
+
+	msg.VendorId = r.ProcessQueryKey
+	warns := make([]string, 0)
+	if len(r.InvalidStaffIdList) > 0 {
+		warns = append(warns, fmt.Sprintf("invalidStaffIdList=%s", strings.Join(r.InvalidStaffIdList, ",")))
+	}
+	if len(r.FlowControlledStaffIdList) > 0 {
+		warns = append(warns, fmt.Sprintf("flowControlledStaffIdList=%s", strings.Join(r.FlowControlledStaffIdList, ",")))
+	}
+	for _, id := range r.InvalidStaffIdList {
+		msg.failRecipient(id, "invalid staff id")
+	}
+	for _, id := range r.FlowControlledStaffIdList {
+		msg.failRecipient(id, "flow controlled")
+	}
+	msg.addWarn(strings.Join(warns, "; "))
+
+	return
+}
+
+// group
+//
+//	https://open.dingtalk.com/document/orgapp/the-robot-sends-a-group-message
+func (d *dingdingApp) group(msg *message, extra map[string]any) (err error) {
+	bs, _ := json.Marshal(msg.ContentMap)
+	keys, errs := make([]string, 0), make([]string, 0)
+	for _, to := range msg.Tos {
+		resp, err := recordedR(msg).
+			SetHeader("x-acs-dingtalk-access-token", d.token).
+			SetBody(lo.Assign(extra, map[string]any{
+				"robotCode":          d.conf["robotCode"],
+				"openConversationId": to,
+				"msgKey":             msg.MsgType,
+				"msgParam":           string(bs),
+			})).
+			Post(d.url(dingdingGroupSendPath))
+
+		RecordResp(msg, err, resp)
+
+		if err = handleErr("send to dingding app group failed", err, resp, func(dt map[string]any) bool {
+			_, ok := dt["processQueryKey"]
+			return ok
+		}); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", to, err))
+			msg.failRecipient(to, err)
+			continue
+		}
+
+		dt := make(map[string]any)
+		_ = json.Unmarshal(resp.Body(), &dt)
+		keys = append(keys, cast.ToString(dt["processQueryKey"]))
+	}
+	msg.VendorId = strings.Join(keys, ",")
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	return
+}
+
+// notify
+//
+//	https://open.dingtalk.com/document/orgapp/asynchronous-sending-of-enterprise-session-messages
+func (d *dingdingApp) notify(msg *message, extra map[string]any) (err error) {
+	if msg.Simple {
+		switch msg.MsgType {
+		case simpleText:
+			msg.ContentMap = map[string]any{
+				"content": msg.Content,
+			}
+		case simpleMarkdown:
+			msg.ContentMap = map[string]any{
+				"title": msg.Title,
+				"text":  msg.Content,
+			}
+		case simpleImage, simpleFile:
+			msg.ContentMap = make(map[string]any)
+		default:
+			return fmt.Errorf("sender type %s does not support simple type %s", d.conf["type"], msg.MsgType)
+		}
+	}
+
+	if len(msg.Attachments) > 0 {
+		if err = d.attach(msg); err != nil {
+			return
+		}
+	}
+
+	body := map[string]any{
+		"agent_id": d.conf["agentId"],
+		"msg": map[string]any{
+			"msgtype":   msg.MsgType,
+			msg.MsgType: msg.ContentMap,
+		},
+	}
+	users, parties := make([]string, 0), make([]string, 0)
+	for _, to := range msg.Tos {
+		switch {
+		case to == "@all":
+			body["to_all_user"] = true
+		case strings.HasPrefix(to, "party:"):
+			parties = append(parties, strings.TrimPrefix(to, "party:"))
+		default:
+			users = append(users, to)
+		}
+	}
+	for k, v := range map[string][]string{"userid_list": users, "dept_id_list": parties} {
+		if len(v) > 0 {
+			body[k] = strings.Join(v, ",")
+		}
+	}
+
+	resp, err := recordedR(msg).
+		SetQueryParam("access_token", d.token).
+		SetBody(lo.Assign(extra, body)).
+		Post(d.oapiURL(dingdingNotifyPath))
+
+	RecordResp(msg, err, resp)
+
+	if err = handleErr("send to dingding app work notification failed", err, resp, func(dt map[string]any) bool { return dt["errcode"] == 0.0 }); err != nil {
+		return
+	}
+
+	r := struct {
+		TaskId json.Number `json:"task_id"`
+	}{}
+	_ = json.Unmarshal(resp.Body(), &r)
+	msg.VendorId = r.TaskId.String()
+
+	return
 }
 
 func (d *dingdingApp) getConf() map[string]string {
 	return d.conf
 }
 
+// recall
+//
+//	https://open.dingtalk.com/document/orgapp/batch-message-recall-chat
+//	https://open.dingtalk.com/document/orgapp/recall-robot-group-chat-messages
+//	https://open.dingtalk.com/document/orgapp/notification-of-work-withdrawal
+func (d *dingdingApp) recall(h *History, origin *message) (err error) {
+	if err = d.checkToken(); err != nil {
+		return
+	}
+
+	var resp *resty.Response
+	keys := strings.Split(h.VendorId, ",")
+	mode := lo.Ternary(cast.ToString(origin.ExtraMap["mode"]) != "", cast.ToString(origin.ExtraMap["mode"]), d.conf["mode"])
+	switch mode {
+	case "", dingdingOto:
+		resp, err = rc.R().
+			SetHeader("x-acs-dingtalk-access-token", d.token).
+			SetBody(map[string]any{
+				"robotCode":        d.conf["robotCode"],
+				"processQueryKeys": keys,
+			}).
+			Post(d.url(dingdingRecallPath))
+	case dingdingGroup:
+		// keys are recorded in the same order of tos when all of them are sent successfully
+		if len(keys) != len(origin.Tos) {
+			return fmt.Errorf("cannot match process query keys %v with open conversation ids %v", keys, origin.Tos)
+		}
+		for i, to := range origin.Tos {
+			resp, err = rc.R().
+				SetHeader("x-acs-dingtalk-access-token", d.token).
+				SetBody(map[string]any{
+					"robotCode":          d.conf["robotCode"],
+					"openConversationId": to,
+					"processQueryKeys":   []string{keys[i]},
+				}).
+				Post(d.url(dingdingGroupRecallPath))
+			if err = handleErr("recall dingding app group message failed", err, resp, func(dt map[string]any) bool { return true }); err != nil {
+				return
+			}
+		}
+		return
+	case dingdingNotify:
+		resp, err = rc.R().
+			SetQueryParam("access_token", d.token).
+			SetBody(map[string]any{
+				"agent_id":    d.conf["agentId"],
+				"msg_task_id": h.VendorId,
+			}).
+			Post(d.oapiURL(dingdingNotifyRecallPath))
+		return handleErr("recall dingding app work notification failed", err, resp, func(dt map[string]any) bool { return dt["errcode"] == 0.0 })
+	default:
+		return fmt.Errorf("sender type %s does not support mode %s", d.conf["type"], mode)
+	}
+
+	return handleErr("recall dingding app message failed", err, resp, func(dt map[string]any) bool { return true })
+}
+
+// attach uploads the attachment as media and puts its media id into content
+//
+//	https://open.dingtalk.com/document/orgapp/upload-media-files
+func (d *dingdingApp) attach(msg *message) (err error) {
+	typ := ""
+	switch msg.MsgType {
+	case simpleImage, dingdingImage:
+		typ = "image"
+	case simpleFile, dingdingFile:
+		typ = "file"
+	default:
+		return fmt.Errorf("sender type %s does not support attachments with message type %s", d.conf["type"], msg.MsgType)
+	}
+
+	name := ""
+	mediaId, err := uploadAttachment(msg, func(n string, bs []byte) (string, error) {
+		name = n
+		resp, err := rc.R().
+			SetQueryParams(map[string]string{
+				"access_token": d.token,
+				"type":         typ,
+			}).
+			SetFileReader("media", n, bytes.NewReader(bs)).
+			Post(d.oapiURL(dingdingUploadPath))
+		if err = handleErr("upload media to dingding app failed", err, resp, func(dt map[string]any) bool { return dt["errcode"] == 0.0 }); err != nil {
+			return "", err
+		}
+		dt := make(map[string]any)
+		_ = json.Unmarshal(resp.Body(), &dt)
+		return cast.ToString(dt["media_id"]), nil
+	})
+	if err != nil {
+		return
+	}
+
+	switch msg.MsgType {
+	case dingdingImage:
+		msg.ContentMap = lo.Assign(msg.ContentMap, map[string]any{"photoURL": mediaId})
+	case dingdingFile:
+		msg.ContentMap = lo.Assign(msg.ContentMap, map[string]any{
+			"mediaId":  mediaId,
+			"fileName": name,
+			"fileType": strings.TrimPrefix(filepath.Ext(name), "."),
+		})
+	default:
+		msg.ContentMap = lo.Assign(msg.ContentMap, map[string]any{"media_id": mediaId})
+	}
+
+	return
+}
+
+// callback verifies dingtalk callbacks, encrypted event subscriptions (eg. interactive card callbacks) are decrypted
+// with callbackToken and callbackAesKey in conf, robot messages are verified by the sign header with appSecret
+//
+//	https://open.dingtalk.com/document/orgapp/configure-event-subcription
+//	https://open.dingtalk.com/document/orgapp/enterprise-created-chatbot
+func (d *dingdingApp) callback(ctx *gin.Context) (event map[string]any, key string, err error) {
+	event = make(map[string]any)
+	if err = ctx.ShouldBindJSON(&event); err != nil {
+		return
+	}
+
+	if encrypted := cast.ToString(event["encrypt"]); encrypted != "" {
+		if d.conf["callbackToken"] == "" {
+			return nil, "", fmt.Errorf("callbackToken is required to verify callbacks")
+		}
+		if !hmac.Equal([]byte(ctx.Query("signature")), []byte(wxSignature(d.conf["callbackToken"], ctx.Query("timestamp"), ctx.Query("nonce"), encrypted))) {
+			return nil, "", fmt.Errorf("invalid signature")
+		}
+		bs, receiveId, e := wxDecrypt(d.conf["callbackAesKey"], encrypted)
+		if e != nil {
+			return nil, "", e
+		}
+		if receiveId != d.conf["appKey"] {
+			return nil, "", fmt.Errorf("invalid receive id %s", receiveId)
+		}
+		event = make(map[string]any)
+		if err = json.Unmarshal(bs, &event); err != nil {
+			return
+		}
+
+		// the response must be encrypted success
+		ts, nonce := cast.ToString(time.Now().Unix()), cast.ToString(time.Now().UnixNano())
+		resp, e := wxEncrypt(d.conf["callbackAesKey"], []byte("success"), d.conf["appKey"])
+		if e != nil {
+			return nil, "", e
+		}
+		ctx.JSON(http.StatusOK, map[string]any{
+			"msg_signature": wxSignature(d.conf["callbackToken"], ts, nonce, resp),
+			"timeStamp":     ts,
+			"nonce":         nonce,
+			"encrypt":       resp,
+		})
+		if event["EventType"] == "check_url" {
+			return nil, "", nil
+		}
+	} else {
+		ts := ctx.GetHeader("timestamp")
+		t := time.UnixMilli(cast.ToInt64(ts))
+		if d.conf["appSecret"] == "" || time.Since(t).Abs() > time.Hour || !hmac.Equal([]byte(ctx.GetHeader("sign")), []byte(d.sign(ts))) {
+			return nil, "", fmt.Errorf("invalid sign")
+		}
+	}
+
+	for _, k := range []string{"outTrackId", "OutTrackId", "msgId"} {
+		if key = cast.ToString(event[k]); key != "" {
+			break
+		}
+	}
+
+	return
+}
+
+// sign with timestamp and appSecret
+func (d *dingdingApp) sign(ts string) string {
+	return base64.StdEncoding.EncodeToString(hmacSha256([]byte(d.conf["appSecret"]), fmt.Sprintf("%s\n%s", ts, d.conf["appSecret"])))
+}
+
 // getUIDByPhone
 //
 //	https://open.dingtalk.com/document/orgapp/query-users-by-phone-number
@@ -101,7 +475,7 @@ func (d *dingdingApp) getUIDByPhone(phone string) (uid string, err error) {
 			"mobile":                           phone,
 		}).
 		SetResult(&r).
-		Post(dingdingGetUIDURL)
+		Post(d.oapiURL(dingdingGetUIDPath))
 
 	if err = handleErr("get uid by phone with dingding app failed", err, resp, func(dt map[string]any) bool { return dt["errcode"] == 0.0 }); err != nil {
 		return
@@ -112,6 +486,16 @@ func (d *dingdingApp) getUIDByPhone(phone string) (uid string, err error) {
 	return
 }
 
+// url uses baseUrl in conf for the new version api
+func (d *dingdingApp) url(path string) string {
+	return getURL(d.conf, "baseUrl", dingdingBaseURL, path)
+}
+
+// oapiURL uses oapiBaseUrl in conf for the old version api
+func (d *dingdingApp) oapiURL(path string) string {
+	return getURL(d.conf, "oapiBaseUrl", dingdingOapiBaseURL, path)
+}
+
 func (d *dingdingApp) checkToken() (err error) {
 	now := time.Now()
 	if !(d.token == "" || d.tokenExpireAt.Before(now)) {
@@ -127,7 +511,7 @@ func (d *dingdingApp) checkToken() (err error) {
 				"appKey":    d.conf["appKey"],
 				"appSecret": d.conf["appSecret"],
 			}).
-			Post(dingdingTokenURL)
+			Post(d.url(dingdingTokenPath))
 
 		// errcode 0 doesnot return as doc when successful
 		// https://open.dingtalk.com/document/orgapp/obtain-orgapp-token?spm=ding_open_doc.document.0.0.454d4a97mHIEGp
@@ -57,7 +57,7 @@ func (d *dingdingBot) send(msg *message) error {
 		}
 	}
 
-	r := rc.SetPreRequestHook(RecordHttpReq(msg)).R().
+	r := recordedR(msg).
 		SetBody(lo.Assign(msg.ExtraMap, map[string]any{
 			"msgtype":   msg.MsgType,
 			msg.MsgType: msg.ContentMap,
@@ -2,6 +2,8 @@ package send
 
 import (
 	"crypto/tls"
+	"fmt"
+	"html"
 	"sync"
 
 	"github.com/samber/lo"
@@ -37,22 +39,56 @@ func (e *email) send(msg *message) (err error) {
 		}
 	})
 
-	m := gomail.NewMessage()
-	m.SetHeader("From", e.conf["account"])
-	m.SetHeader("To", msg.Tos...)
-	m.SetHeader("Subject", msg.Title)
-	m.SetHeader("Cc", msg.Ccs...)
-	m.SetBody(msg.MsgType, msg.Content)
-
-	RecordEmailReq(msg, m)
-
-	err = e.d.DialAndSend(m)
+	urls := lo.Map(msg.Tos, func(to string, _ int) string { return unsubscribeURL(msg.Tenant, to, msg.Category) })
+	if len(lo.Compact(urls)) <= 0 {
+		m := e.newMail(msg, msg.Tos, msg.Ccs, "")
+		RecordEmailReq(msg, m)
+		err = e.d.DialAndSend(m)
+		RecordResp(msg, err, nil)
+		return
+	}
 
+	// emails with unsubscription links are sent to each recipient, failures of some recipients do not stop the others
+	ms := lo.Map(msg.Tos, func(to string, i int) *gomail.Message {
+		return e.newMail(msg, []string{to}, lo.Ternary(i == 0, msg.Ccs, nil), urls[i])
+	})
+	RecordEmailReq(msg, ms...)
+	failed := 0
+	for i, m := range ms {
+		// a new connection is used for each email since the smtp session is not reset after a rejected recipient
+		if err1 := e.d.DialAndSend(m); err1 != nil {
+			failed++
+			msg.failRecipient(msg.Tos[i], err1)
+			err = err1
+		}
+	}
+	// the message fails only if all recipients failed
+	err = lo.Ternary(failed == len(ms), err, nil)
 	RecordResp(msg, err, nil)
 
 	return
 }
 
+// newMail returns an email with List-Unsubscribe header and the unsubscription link in body if url is not empty
+//
+//	https://datatracker.ietf.org/doc/html/rfc8058
+func (e *email) newMail(msg *message, tos, ccs []string, url string) *gomail.Message {
+	m := gomail.NewMessage()
+	m.SetHeader("From", e.conf["account"])
+	m.SetHeader("To", tos...)
+	m.SetHeader("Subject", msg.Title)
+	m.SetHeader("Cc", ccs...)
+	body := msg.Content
+	if url != "" {
+		m.SetHeader("List-Unsubscribe", fmt.Sprintf("<%s>", url))
+		m.SetHeader("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
+		body += lo.Ternary(msg.MsgType == "text/html", fmt.Sprintf(`<p><a href="%s">退订此类邮件</a></p>`, html.EscapeString(url)), fmt.Sprintf("\n\n退订此类邮件: %s", url))
+	}
+	m.SetBody(msg.MsgType, body)
+
+	return m
+}
+
 func (e *email) getConf() map[string]string {
 	return e.conf
 }
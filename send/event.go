@@ -0,0 +1,119 @@
+package send
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+)
+
+const (
+	eventQueued  = "queued"
+	eventSent    = "sent"
+	eventFailed  = "failed"
+	eventRetried = "retried"
+	// eventSuppressed is for messages which are not sent since all recipients are suppressed by preferences
+	eventSuppressed = "suppressed"
+
+	heartbeatInterval = time.Second * 15
+)
+
+var (
+	subscribers = make(map[chan *event]struct{})
+	subMtx      = &sync.RWMutex{}
+)
+
+type event struct {
+	Type      string `json:"type"`
+	Id        string `json:"id"`
+	HistoryId int    `json:"history_id"`
+	Sender    string `json:"sender"`
+	Tenant    string `json:"-"`
+	Err       string `json:"err"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// publishEvent sends the event of msg to all subscribers, events are dropped for slow subscribers
+func publishEvent(typ string, msg *message) {
+	e := &event{
+		Type:      typ,
+		Id:        msg.Id,
+		HistoryId: msg.HistoryId,
+		Sender:    msg.Sender,
+		Tenant:    msg.Tenant,
+		CreatedAt: time.Now().Unix(),
+	}
+	if msg.Err != nil {
+		e.Err = msg.Err.Error()
+	}
+
+	subMtx.RLock()
+	defer subMtx.RUnlock()
+	for ch := range subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// enqueue pushes msg to send asynchronously
+func enqueue(msg *message) {
+	publishEvent(eventQueued, msg)
+	msgCh <- msg
+}
+
+// Events
+//
+//	@Tags			send
+//	@Description	subscribe message events of the authenticated tenant with server-sent events, event types are queued, sent, failed, retried and suppressed
+//	@Produce		text/event-stream
+//	@Param			sender	query		string	false	"sender names separated by comma"
+//	@Param			status	query		string	false	"event types separated by comma"
+//	@Success		200		{object}	event
+//	@Router			/v1/events [GET]
+func Events(ctx *gin.Context) {
+	senders := lo.Compact(strings.Split(ctx.Query("sender"), ","))
+	types := lo.Compact(strings.Split(ctx.Query("status"), ","))
+	tenant := tenantOf(ctx)
+
+	ch := make(chan *event, 100)
+	subMtx.Lock()
+	subscribers[ch] = struct{}{}
+	subMtx.Unlock()
+	defer func() {
+		subMtx.Lock()
+		delete(subscribers, ch)
+		subMtx.Unlock()
+	}()
+
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	// disable buffering of nginx
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+	ctx.Writer.Flush()
+
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		case <-ticker.C:
+			if _, err := ctx.Writer.WriteString(": heartbeat\n\n"); err != nil {
+				return
+			}
+		case e := <-ch:
+			if e.Tenant != tenant || (len(senders) > 0 && !lo.Contains(senders, e.Sender)) || (len(types) > 0 && !lo.Contains(types, e.Type)) {
+				continue
+			}
+			ctx.SSEvent(e.Type, e)
+		}
+		ctx.Writer.Flush()
+	}
+}
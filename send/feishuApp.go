@@ -1,20 +1,39 @@
 package send
 
 import (
+	"bytes"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/go-resty/resty/v2"
 	"github.com/samber/lo"
 	"github.com/spf13/cast"
 )
 
 const (
-	feishuTokenURL  = "https://open.feishu.cn/open-apis/auth/v3/app_access_token/internal"
-	feishuSendURL   = "https://open.feishu.cn/open-apis/message/v4/batch_send/"
-	feishuGetUIDURL = "https://open.feishu.cn/open-apis/contact/v3/users/batch_get_id"
+	feishuBaseURL          = "https://open.feishu.cn"
+	feishuTokenPath        = "/open-apis/auth/v3/app_access_token/internal"
+	feishuSendPath         = "/open-apis/message/v4/batch_send/"
+	feishuMessagePath      = "/open-apis/im/v1/messages"
+	feishuBatchMessagePath = "/open-apis/im/v1/batch_messages"
+	feishuGetUIDPath       = "/open-apis/contact/v3/users/batch_get_id"
+	feishuImagePath        = "/open-apis/im/v1/images"
+	feishuFilePath         = "/open-apis/im/v1/files"
+
+	feishuBatchMessagePrefix = "bm-"
+	// feishuBatchSize is the max count of user ids of batch_send
+	feishuBatchSize = 200
+	// feishuLookupSize is the max count of mobiles or emails of batch_get_id
+	feishuLookupSize = 50
 )
 
 func init() {
@@ -30,9 +49,11 @@ type feishuApp struct {
 	tokenExpireAt time.Time
 }
 
-// send feishu app message
+// send feishu app message, messages are sent in batch to user ids by default,
+// if receive_id_type is set in extra or conf, ie. chat_id, open_id, union_id, email or user_id, they are sent one by one
 //
 //	https://open.feishu.cn/document/server-docs/im-v1/batch_message/send-messages-in-batches
+//	https://open.feishu.cn/document/server-docs/im-v1/message/create
 func (f *feishuApp) send(msg *message) (err error) {
 	if err = f.checkToken(); err != nil {
 		return
@@ -44,33 +65,314 @@ func (f *feishuApp) send(msg *message) (err error) {
 			msg.ContentMap = map[string]any{
 				msg.MsgType: msg.Content,
 			}
+		case feishuInteractive:
+			msg.ContentMap = feishuCard(msg.Title, msg.Content)
+		case simpleImage, simpleFile:
+			msg.ContentMap = make(map[string]any)
 		default:
 			return fmt.Errorf("sender type %s does not support simple type %s", f.conf["type"], msg.MsgType)
 		}
 	}
-	resp, err := rc.SetPreRequestHook(RecordHttpReq(msg)).R().
+
+	if err = atMobilesToAts(f, msg); err != nil {
+		return
+	}
+	feishuAt(msg)
+
+	if len(msg.Attachments) > 0 {
+		if err = f.attach(msg); err != nil {
+			return
+		}
+	}
+
+	receiveIdType := lo.Ternary(cast.ToString(msg.ExtraMap["receive_id_type"]) != "", cast.ToString(msg.ExtraMap["receive_id_type"]), f.conf["receive_id_type"])
+	extra := lo.OmitByKeys(msg.ExtraMap, []string{"receive_id_type"})
+	if receiveIdType == "" {
+		return f.batchSend(msg, extra)
+	}
+
+	bs, _ := json.Marshal(msg.ContentMap)
+	msgIds, errs := make([]string, 0), make([]string, 0)
+	for _, to := range msg.Tos {
+		resp, err := recordedR(msg).
+			SetAuthToken(f.token).
+			SetQueryParam("receive_id_type", receiveIdType).
+			SetBody(lo.Assign(extra, map[string]any{
+				"receive_id": to,
+				"msg_type":   msg.MsgType,
+				"content":    string(bs),
+			})).
+			Post(f.url(feishuMessagePath))
+
+		RecordResp(msg, err, resp)
+
+		if err = handleErr("send to feishu app failed", err, resp, func(dt map[string]any) bool { return dt["code"] == 0.0 }); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", to, err))
+			msg.failRecipient(to, err)
+			continue
+		}
+
+		dt := make(map[string]any)
+		_ = json.Unmarshal(resp.Body(), &dt)
+		msgIds = append(msgIds, cast.ToString(cast.ToStringMap(dt["data"])["message_id"]))
+	}
+	msg.VendorId = strings.Join(msgIds, ",")
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	return
+}
+
+func (f *feishuApp) batchSend(msg *message, extra map[string]any) (err error) {
+	resp, err := recordedR(msg).
 		SetAuthToken(f.token).
 		SetQueryParam("receive_id_type", "user_id").
-		SetBody(lo.Assign(msg.ExtraMap, map[string]any{
+		SetBody(lo.Assign(extra, map[string]any{
 			"user_ids": msg.Tos,
 			"msg_type": msg.MsgType,
-			"content":  msg.ContentMap,
+			// cards are sent in field card instead of content
+			lo.Ternary(msg.MsgType == feishuInteractive, "card", "content"): msg.ContentMap,
 		})).
-		Post(feishuSendURL)
+		Post(f.url(feishuSendPath))
 
 	RecordResp(msg, err, resp)
 
-	return handleErr("send to feishu app failed", err, resp, func(dt map[string]any) bool { return dt["code"] == 0.0 })
+	if err = handleErr("send to feishu app failed", err, resp, func(dt map[string]any) bool { return dt["code"] == 0.0 }); err != nil {
+		return
+	}
+
+	dt := make(map[string]any)
+	_ = json.Unmarshal(resp.Body(), &dt)
+	data := cast.ToStringMap(dt["data"])
+	msg.VendorId = cast.ToString(data["message_id"])
+	for _, id := range cast.ToStringSlice(data["invalid_user_ids"]) {
+		msg.failRecipient(id, "invalid user id")
+	}
+
+	return
+}
+
+// sendBatch merges messages with the same content into one batch_send request,
+// messages sent one by one with receive_id_type or with attachments are sent as usual
+func (f *feishuApp) sendBatch(msgs []*message) {
+	groups := lo.GroupBy(msgs, func(m *message) string {
+		if m.ExtraMap["receive_id_type"] != nil || f.conf["receive_id_type"] != "" || len(m.Attachments) > 0 {
+			return ""
+		}
+		bs, _ := json.Marshal([]any{m.MsgType, m.Simple, m.Title, m.Content, m.ExtraMap, m.Ats, m.AtMobiles})
+		return string(bs)
+	})
+	for key, ms := range groups {
+		chunks := lo.Ternary(key == "", lo.Chunk(ms, 1), chunkByTos(ms, feishuBatchSize))
+		for _, chunk := range chunks {
+			if len(chunk) == 1 {
+				chunk[0].Err = f.send(chunk[0])
+				continue
+			}
+			merged := *chunk[0]
+			merged.Tos = lo.Uniq(lo.FlatMap(chunk, func(m *message, _ int) []string { return m.Tos }))
+			merged.Recipients = nil
+			err := f.send(&merged)
+			for _, m := range chunk {
+				m.Req, m.Resp, m.VendorId, m.Warn, m.Err = merged.Req, merged.Resp, merged.VendorId, merged.Warn, err
+				m.Recipients = lo.Filter(merged.Recipients, func(r *Recipient, _ int) bool { return lo.Contains(m.Tos, r.Recipient) })
+			}
+		}
+	}
 }
 
 func (f *feishuApp) getConf() map[string]string {
 	return f.conf
 }
 
+// attach uploads the attachment as image or file and puts its image_key or file_key into content
+//
+//	https://open.feishu.cn/document/server-docs/im-v1/image/create
+//	https://open.feishu.cn/document/server-docs/im-v1/file/create
+func (f *feishuApp) attach(msg *message) (err error) {
+	path, field, key, formData := "", "", "", map[string]string{}
+	switch msg.MsgType {
+	case simpleImage:
+		path, field, key, formData = feishuImagePath, "image", "image_key", map[string]string{"image_type": "message"}
+	case simpleFile:
+		path, field, key, formData = feishuFilePath, "file", "file_key", map[string]string{"file_type": "stream"}
+	default:
+		return fmt.Errorf("sender type %s does not support attachments with message type %s", f.conf["type"], msg.MsgType)
+	}
+
+	mediaKey, err := uploadAttachment(msg, func(name string, bs []byte) (string, error) {
+		if msg.MsgType == simpleFile {
+			formData["file_name"] = name
+		}
+		resp, err := rc.R().
+			SetAuthToken(f.token).
+			SetFormData(formData).
+			SetFileReader(field, name, bytes.NewReader(bs)).
+			Post(f.url(path))
+		if err = handleErr("upload to feishu app failed", err, resp, func(dt map[string]any) bool { return dt["code"] == 0.0 }); err != nil {
+			return "", err
+		}
+		dt := make(map[string]any)
+		_ = json.Unmarshal(resp.Body(), &dt)
+		return cast.ToString(cast.ToStringMap(dt["data"])[key]), nil
+	})
+	if err != nil {
+		return
+	}
+	msg.ContentMap = lo.Assign(msg.ContentMap, map[string]any{key: mediaKey})
+
+	return
+}
+
+// update updates text, post and card messages, messages sent in batch cannot be updated
+//
+//	https://open.feishu.cn/document/server-docs/im-v1/message/update
+//	https://open.feishu.cn/document/server-docs/im-v1/message-card/patch
+func (f *feishuApp) update(h *History, origin *message, msg *message) (err error) {
+	if err = f.checkToken(); err != nil {
+		return
+	}
+
+	if msg.Simple {
+		switch msg.MsgType {
+		case simpleText:
+			msg.ContentMap = map[string]any{
+				msg.MsgType: msg.Content,
+			}
+		case feishuInteractive:
+			msg.ContentMap = feishuCard(msg.Title, msg.Content)
+		default:
+			return fmt.Errorf("sender type %s does not support simple type %s", f.conf["type"], msg.MsgType)
+		}
+	}
+
+	bs, _ := json.Marshal(msg.ContentMap)
+	for _, id := range strings.Split(h.VendorId, ",") {
+		if strings.HasPrefix(id, feishuBatchMessagePrefix) {
+			return fmt.Errorf("message %s sent in batch cannot be updated", id)
+		}
+		r := rc.R().SetAuthToken(f.token)
+		var resp *resty.Response
+		if msg.MsgType == feishuInteractive {
+			resp, err = r.SetBody(map[string]any{"content": string(bs)}).
+				Patch(f.url(fmt.Sprintf("%s/%s", feishuMessagePath, id)))
+		} else {
+			resp, err = r.SetBody(map[string]any{"msg_type": msg.MsgType, "content": string(bs)}).
+				Put(f.url(fmt.Sprintf("%s/%s", feishuMessagePath, id)))
+		}
+		if err = handleErr("update feishu app message failed", err, resp, func(dt map[string]any) bool { return dt["code"] == 0.0 }); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// recall
+//
+//	https://open.feishu.cn/document/server-docs/im-v1/message/delete
+//	https://open.feishu.cn/document/server-docs/im-v1/batch_message/delete
+func (f *feishuApp) recall(h *History, origin *message) (err error) {
+	if err = f.checkToken(); err != nil {
+		return
+	}
+
+	for _, id := range strings.Split(h.VendorId, ",") {
+		path := lo.Ternary(strings.HasPrefix(id, feishuBatchMessagePrefix), feishuBatchMessagePath, feishuMessagePath)
+		resp, err := rc.R().
+			SetAuthToken(f.token).
+			Delete(f.url(fmt.Sprintf("%s/%s", path, id)))
+		if err = handleErr("recall feishu app message failed", err, resp, func(dt map[string]any) bool { return dt["code"] == 0.0 }); err != nil {
+			return err
+		}
+	}
+
+	return
+}
+
+// callback verifies and decrypts feishu event and card callbacks with encryptKey in conf, verificationToken is checked if set
+//
+//	https://open.feishu.cn/document/server-docs/event-subscription-guide/event-subscription-configure-/encrypt-key-encryption-configuration-case
+//	https://open.feishu.cn/document/uAjLw4CM/ukzMukzMukzM/feishu-cards/card-callback-communication
+func (f *feishuApp) callback(ctx *gin.Context) (event map[string]any, key string, err error) {
+	body, err := ctx.GetRawData()
+	if err != nil {
+		return
+	}
+	event = make(map[string]any)
+	if err = json.Unmarshal(body, &event); err != nil {
+		return
+	}
+
+	// the signature depends on encryptKey, callbacks cannot be verified without it
+	ek := f.conf["encryptKey"]
+	if ek == "" {
+		return nil, "", fmt.Errorf("encryptKey is required to verify callbacks")
+	}
+	bs, err := feishuDecrypt(ek, cast.ToString(event["encrypt"]))
+	if err != nil {
+		return
+	}
+	event = make(map[string]any)
+	if err = json.Unmarshal(bs, &event); err != nil {
+		return
+	}
+	// url verification is not signed, it is answered with the challenge only and never recorded
+	if event["type"] != "url_verification" {
+		sig := ctx.GetHeader("X-Lark-Signature")
+		if sig == "" || !hmac.Equal([]byte(sig), []byte(feishuSignature(ek, ctx.GetHeader("X-Lark-Request-Timestamp"), ctx.GetHeader("X-Lark-Request-Nonce"), body))) {
+			return nil, "", fmt.Errorf("invalid signature")
+		}
+	}
+
+	if vt := f.conf["verificationToken"]; vt != "" && !hmac.Equal([]byte(vt), []byte(lo.Ternary(dig(event, "header.token") != "", dig(event, "header.token"), dig(event, "token")))) {
+		return nil, "", fmt.Errorf("invalid verification token")
+	}
+
+	if event["type"] == "url_verification" {
+		ctx.JSON(http.StatusOK, map[string]any{"challenge": event["challenge"]})
+		return nil, "", nil
+	}
+
+	for _, p := range []string{"event.context.open_message_id", "open_message_id", "event.message.message_id"} {
+		if key = dig(event, p); key != "" {
+			break
+		}
+	}
+	ctx.JSON(http.StatusOK, map[string]any{})
+
+	return
+}
+
+// feishuSignature is the hex of sha256 of timestamp, nonce, encryptKey and body
+func feishuSignature(encryptKey, ts, nonce string, body []byte) string {
+	return sha256Hex([]byte(ts + nonce + encryptKey + string(body)))
+}
+
+// feishuDecrypt decrypts the encrypted event with aes cbc, the key is sha256 of encryptKey and iv is the first block
+func feishuDecrypt(encryptKey, encrypt string) ([]byte, error) {
+	encrypted, err := base64.StdEncoding.DecodeString(encrypt)
+	if err != nil || len(encrypted) < aes.BlockSize {
+		return nil, fmt.Errorf("invalid encrypted body, err=%v", err)
+	}
+	k := sha256.Sum256([]byte(encryptKey))
+	return aesCBCDecrypt(k[:], encrypted[:aes.BlockSize], encrypted[aes.BlockSize:])
+}
+
 // getUIDByPhone
 //
 //	https://open.feishu.cn/open-apis/contact/v3/users/batch_get_id
 func (f *feishuApp) getUIDByPhone(phone string) (uid string, err error) {
+	uids, err := f.lookupUIDs([]string{phone}, nil)
+	return uids[phone], err
+}
+
+// lookupUIDs queries user ids of mobiles and emails, at most 50 mobiles and 50 emails are queried in one request
+//
+//	https://open.feishu.cn/open-apis/contact/v3/users/batch_get_id
+func (f *feishuApp) lookupUIDs(phones, emails []string) (uids map[string]string, err error) {
 	if err = f.checkToken(); err != nil {
 		return
 	}
@@ -79,31 +381,45 @@ func (f *feishuApp) getUIDByPhone(phone string) (uid string, err error) {
 		Data struct {
 			UserList []struct {
 				UserID string `json:"user_id"`
+				Mobile string `json:"mobile"`
+				Email  string `json:"email"`
 			} `json:"user_list"`
 		} `json:"data"`
 	}
-	r := &res{}
 
-	resp, err := rc.R().
-		SetAuthToken(f.token).
-		SetQueryParam("user_id_type", "user_id").
-		SetBody(map[string]any{
-			"mobiles": []string{phone},
-		}).
-		SetResult(r).
-		Post(feishuGetUIDURL)
-
-	if err = handleErr("get uid by phone with feishu app failed", err, resp, func(dt map[string]any) bool { return dt["code"] == 0.0 }); err != nil {
-		return
-	}
+	uids = make(map[string]string)
+	for i := 0; i < len(phones) || i < len(emails); i += feishuLookupSize {
+		r := &res{}
+		resp, err := rc.R().
+			SetAuthToken(f.token).
+			SetQueryParam("user_id_type", "user_id").
+			SetBody(map[string]any{
+				"mobiles": phones[lo.Clamp(i, 0, len(phones)):lo.Clamp(i+feishuLookupSize, 0, len(phones))],
+				"emails":  emails[lo.Clamp(i, 0, len(emails)):lo.Clamp(i+feishuLookupSize, 0, len(emails))],
+			}).
+			SetResult(r).
+			Post(f.url(feishuGetUIDPath))
+
+		if err = handleErr("get uid with feishu app failed", err, resp, func(dt map[string]any) bool { return dt["code"] == 0.0 }); err != nil {
+			return nil, err
+		}
 
-	if len(r.Data.UserList) > 0 {
-		uid = r.Data.UserList[0].UserID
+		for _, u := range r.Data.UserList {
+			if u.UserID == "" {
+				continue
+			}
+			uids[lo.Ternary(u.Mobile != "", u.Mobile, u.Email)] = u.UserID
+		}
 	}
 
 	return
 }
 
+// url uses baseUrl in conf, eg. https://open.larksuite.com for lark
+func (f *feishuApp) url(path string) string {
+	return getURL(f.conf, "baseUrl", feishuBaseURL, path)
+}
+
 func (f *feishuApp) checkToken() (err error) {
 	now := time.Now()
 	if !(f.token == "" || f.tokenExpireAt.Before(now)) {
@@ -116,7 +432,7 @@ func (f *feishuApp) checkToken() (err error) {
 		var resp *resty.Response
 		resp, err = rc.R().
 			SetBody(map[string]string{"app_id": f.conf["app_id"], "app_secret": f.conf["app_secret"]}).
-			Post(feishuTokenURL)
+			Post(f.url(feishuTokenPath))
 
 		if err = handleErr("get feishu token failed", err, resp, func(dt map[string]any) bool { return dt["code"] == 0.0 }); err != nil {
 			return
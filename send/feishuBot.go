@@ -1,10 +1,20 @@
 package send
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/samber/lo"
+	"github.com/spf13/cast"
+)
+
+const (
+	feishuPost        = "post"
+	feishuInteractive = "interactive"
 )
 
 func init() {
@@ -27,27 +37,51 @@ func (f *feishuBot) send(msg *message) error {
 			msg.ContentMap = map[string]any{
 				msg.MsgType: msg.Content,
 			}
+		case feishuPost:
+			msg.ContentMap = map[string]any{
+				feishuPost: map[string]any{
+					"zh_cn": map[string]any{
+						"title": msg.Title,
+						"content": lo.Map(strings.Split(msg.Content, "\n"), func(s string, _ int) []map[string]any {
+							return []map[string]any{{"tag": "text", "text": s}}
+						}),
+					},
+				},
+			}
+		case feishuInteractive:
+			msg.ContentMap = feishuCard(msg.Title, msg.Content)
 		default:
 			return fmt.Errorf("sender type %s does not support simple type %s", f.conf["type"], msg.MsgType)
 		}
 	}
 
-	if len(msg.Ats) > 0 {
-		switch msg.MsgType {
-		case simpleText:
-			msg.ContentMap["text"] = fmt.Sprintf("%v \n %s",
-				msg.ContentMap["text"],
-				strings.Join(lo.Map(msg.Ats, func(s string, _ int) string {
-					return fmt.Sprintf("<at user_id=\"%s\"></at>", lo.Ternary(s == "@all", "all", s))
-				}), " "))
+	// at_mobiles are converted with the feishuApp in lookupSender, they are ignored as before if it is not configured
+	if len(msg.AtMobiles) > 0 && f.conf["lookupSender"] == "" {
+		msg.addWarn("at_mobiles are ignored since lookupSender is not configured")
+	} else if len(msg.AtMobiles) > 0 {
+		ls, ok := getSender(f.conf["tenant"], f.conf["lookupSender"])
+		if !ok {
+			return fmt.Errorf("cannot find lookupSender with name %s", f.conf["lookupSender"])
 		}
+		if err := atMobilesToAts(ls, msg); err != nil {
+			return err
+		}
+	}
+	feishuAt(msg)
+
+	body := lo.Assign(msg.ExtraMap, map[string]any{
+		"msg_type": msg.MsgType,
+		// cards are sent in field card instead of content
+		lo.Ternary(msg.MsgType == feishuInteractive, "card", "content"): msg.ContentMap,
+	})
+	if f.conf["secret"] != "" {
+		ts := cast.ToString(time.Now().Unix())
+		body["timestamp"] = ts
+		body["sign"] = f.sign(ts)
 	}
 
-	resp, err := rc.SetPreRequestHook(RecordHttpReq(msg)).R().
-		SetBody(lo.Assign(msg.ExtraMap, map[string]any{
-			"msg_type": msg.MsgType,
-			"content":  msg.ContentMap,
-		})).
+	resp, err := recordedR(msg).
+		SetBody(body).
 		Post(f.conf["url"])
 
 	RecordResp(msg, err, resp)
@@ -58,3 +92,52 @@ func (f *feishuBot) send(msg *message) error {
 func (f *feishuBot) getConf() map[string]string {
 	return f.conf
 }
+
+// sign with timestamp and secret
+//
+//	https://open.feishu.cn/document/client-docs/bot-v3/add-custom-bot#3c6592d6
+func (f *feishuBot) sign(ts string) string {
+	mac := hmac.New(sha256.New, []byte(fmt.Sprintf("%s\n%s", ts, f.conf["secret"])))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// feishuAt appends ats to text, and simple post and interactive messages
+func feishuAt(msg *message) {
+	if len(msg.Ats) <= 0 {
+		return
+	}
+	switch msg.MsgType {
+	case simpleText:
+		msg.ContentMap["text"] = fmt.Sprintf("%v \n %s",
+			msg.ContentMap["text"],
+			strings.Join(lo.Map(msg.Ats, func(s string, _ int) string {
+				return fmt.Sprintf("<at user_id=\"%s\"></at>", lo.Ternary(s == "@all", "all", s))
+			}), " "))
+	case feishuPost:
+		if msg.Simple {
+			post := msg.ContentMap[feishuPost].(map[string]any)["zh_cn"].(map[string]any)
+			post["content"] = append(post["content"].([][]map[string]any), lo.Map(msg.Ats, func(s string, _ int) map[string]any {
+				return map[string]any{"tag": "at", "user_id": lo.Ternary(s == "@all", "all", s)}
+			}))
+		}
+	case feishuInteractive:
+		if msg.Simple {
+			msg.ContentMap["elements"] = append(msg.ContentMap["elements"].([]map[string]any), map[string]any{
+				"tag": "markdown",
+				"content": strings.Join(lo.Map(msg.Ats, func(s string, _ int) string {
+					return fmt.Sprintf("<at id=%s></at>", lo.Ternary(s == "@all", "all", s))
+				}), " "),
+			})
+		}
+	}
+}
+
+// feishuCard returns a card with title as header and content as markdown
+func feishuCard(title, content string) map[string]any {
+	return map[string]any{
+		"header": map[string]any{
+			"title": map[string]any{"tag": "plain_text", "content": title},
+		},
+		"elements": []map[string]any{{"tag": "markdown", "content": content}},
+	}
+}
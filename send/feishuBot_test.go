@@ -0,0 +1,29 @@
+package send
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFeishuBotAtMobilesWithoutLookupSender(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"code":0}`))
+	}))
+	defer srv.Close()
+
+	f := &feishuBot{conf: map[string]string{"name": "bot", "type": "feishuBot", "url": srv.URL}}
+	msg := &message{MsgType: simpleText, Simple: true, Content: "disk full", AtMobiles: []string{"13800000000"}}
+	if err := f.send(msg); err != nil {
+		t.Fatalf("send = %v", err)
+	}
+	if !strings.Contains(msg.Warn, "lookupSender") {
+		t.Errorf("warn = %s", msg.Warn)
+	}
+
+	f.conf["lookupSender"] = "nosuch"
+	if err := f.send(&message{MsgType: simpleText, Simple: true, Content: "disk full", AtMobiles: []string{"13800000000"}}); err == nil {
+		t.Errorf("send with unknown lookupSender should fail")
+	}
+}
@@ -0,0 +1,79 @@
+package send
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+)
+
+func init() {
+	registered["gotify"] = func(conf map[string]string) sender {
+		return &gotify{conf: conf}
+	}
+}
+
+type gotify struct {
+	conf map[string]string
+}
+
+// send gotify message with the application token in conf
+//
+//	https://gotify.net/api-docs#/message/createMessage
+//	https://gotify.net/docs/msgextras
+func (g *gotify) send(msg *message) error {
+	if msg.Simple {
+		switch msg.MsgType {
+		case simpleText, simpleMarkdown:
+			msg.ContentMap = map[string]any{
+				"title":   msg.Title,
+				"message": msg.Content,
+				"extras": map[string]any{
+					"client::display": map[string]any{
+						"contentType": lo.Ternary(msg.MsgType == simpleMarkdown, "text/markdown", "text/plain"),
+					},
+				},
+			}
+		default:
+			return fmt.Errorf("sender type %s does not support simple type %s", g.conf["type"], msg.MsgType)
+		}
+	}
+
+	body := lo.OmitByKeys(lo.Assign(msg.ExtraMap, msg.ContentMap), []string{"url", "icon"})
+	if v, ok := msg.ExtraMap["priority"]; ok {
+		body["priority"] = cast.ToInt(v)
+	}
+	notification := make(map[string]any)
+	if v, ok := msg.ExtraMap["url"]; ok {
+		notification["click"] = map[string]any{"url": v}
+	}
+	if v, ok := msg.ExtraMap["icon"]; ok {
+		notification["bigImageUrl"] = v
+	}
+	if len(notification) > 0 {
+		extras, _ := body["extras"].(map[string]any)
+		body["extras"] = lo.Assign(extras, map[string]any{"client::notification": notification})
+	}
+
+	resp, err := recordedR(msg).
+		SetHeader("X-Gotify-Key", g.conf["token"]).
+		SetBody(body).
+		Post(getURL(g.conf, "url", "", "/message"))
+
+	RecordResp(msg, err, resp)
+
+	if err = handleErr("send to gotify failed", err, resp, func(dt map[string]any) bool { return dt["id"] != nil }); err != nil {
+		return err
+	}
+
+	dt := make(map[string]any)
+	_ = json.Unmarshal(resp.Body(), &dt)
+	msg.VendorId = cast.ToString(dt["id"])
+
+	return nil
+}
+
+func (g *gotify) getConf() map[string]string {
+	return g.conf
+}
@@ -0,0 +1,209 @@
+package send
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+
+	"github.com/veops/messenger/global"
+)
+
+const (
+	alertFiring   = "firing"
+	alertResolved = "resolved"
+
+	formatMarkdown = "markdown"
+	formatHTML     = "html"
+	formatText     = "text"
+)
+
+var (
+	// defaultAlertTemplate is rendered as markdown, it is converted to html for email and kept as it is for plain text
+	defaultAlertTemplate = template.Must(template.New("default").Funcs(alertTemplateFuncs).Parse(
+		`{{ range .Alerts }}**[{{ .Status | upper }}] {{ index .Labels "alertname" }}**
+{{ with index .Annotations "summary" }}> {{ . }}
+{{ end }}{{ with index .Annotations "description" }}> {{ . }}
+{{ end }}- 开始时间: {{ .StartsAt | timeFormat }}
+{{ if and (eq .Status "resolved") (not .EndsAt.IsZero) }}- 恢复时间: {{ .EndsAt | timeFormat }}
+{{ end }}{{ with .ValueString }}- 当前值: {{ . }}
+{{ end }}- 标签: {{ range $k, $v := .Labels }}{{ $k }}={{ $v }} {{ end }}
+{{ with .GeneratorURL }}- [详情]({{ . }})
+{{ end }}
+{{ end }}`))
+	alertTemplateFuncs = template.FuncMap{
+		"upper":      strings.ToUpper,
+		"lower":      strings.ToLower,
+		"join":       strings.Join,
+		"timeFormat": func(t time.Time) string { return t.Local().Format("2006-01-02 15:04:05") },
+	}
+)
+
+type alert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+	// fields below are only sent by grafana
+	DashboardURL string `json:"dashboardURL"`
+	PanelURL     string `json:"panelURL"`
+	ValueString  string `json:"valueString"`
+}
+
+// alertGroup is the normalized alerts from integrations, its fields are the same as alertmanager webhook
+type alertGroup struct {
+	Status            string            `json:"status"`
+	Receiver          string            `json:"receiver"`
+	GroupKey          string            `json:"groupKey"`
+	GroupLabels       map[string]string `json:"groupLabels"`
+	CommonLabels      map[string]string `json:"commonLabels"`
+	CommonAnnotations map[string]string `json:"commonAnnotations"`
+	ExternalURL       string            `json:"externalURL"`
+	Alerts            []*alert          `json:"alerts"`
+	// Title is rendered by grafana, it is used as message title if not empty
+	Title string `json:"title"`
+}
+
+func (g *alertGroup) Firing() []*alert {
+	return lo.Filter(g.Alerts, func(a *alert, _ int) bool { return a.Status == alertFiring })
+}
+
+func (g *alertGroup) Resolved() []*alert {
+	return lo.Filter(g.Alerts, func(a *alert, _ int) bool { return a.Status == alertResolved })
+}
+
+func (g *alertGroup) title() string {
+	if g.Title != "" {
+		return g.Title
+	}
+	name := g.CommonLabels["alertname"]
+	if name == "" {
+		ks := lo.Keys(g.GroupLabels)
+		sort.Strings(ks)
+		name = strings.Join(lo.Map(ks, func(k string, _ int) string { return fmt.Sprintf("%s=%s", k, g.GroupLabels[k]) }), " ")
+	}
+	return fmt.Sprintf("[%s:%d] %s", strings.ToUpper(g.Status), len(lo.Ternary(g.Status == alertResolved, g.Resolved(), g.Firing())), name)
+}
+
+// pushAlerts renders the alerts for the sender in query or integration conf, and pushes the message to send
+func pushAlerts(ctx *gin.Context, name string, g *alertGroup) {
+	tenant := tenantOf(ctx)
+	conf, err := global.GetIntegrationConf(tenant, name)
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	senderName := lo.Ternary(ctx.Query("sender") != "", ctx.Query("sender"), conf.Sender)
+	s, ok := getSender(tenant, senderName)
+	if !ok {
+		ctx.AbortWithError(http.StatusBadRequest, fmt.Errorf("cannot find sender with name %s", senderName))
+		return
+	}
+
+	m, err := renderAlerts(s, lo.Ternary(ctx.Query("template") != "", ctx.Query("template"), conf.Template), g)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	m.Sender, m.Tenant = senderName, tenant
+	m.ReceivedAt = time.Now().Unix()
+	m.Severity = g.CommonLabels["severity"]
+
+	for _, r := range conf.Rules {
+		if !lo.SomeBy(g.Alerts, func(a *alert) bool { return matchLabels(r.Match, a.Labels) }) {
+			continue
+		}
+		m.Tos = append(m.Tos, r.Tos...)
+		m.Ats = append(m.Ats, r.Ats...)
+		m.AtMobiles = append(m.AtMobiles, r.AtMobiles...)
+	}
+	m.Tos, m.Ats, m.AtMobiles = lo.Uniq(m.Tos), lo.Uniq(m.Ats), lo.Uniq(m.AtMobiles)
+	// keep extra in history so that the message could be resent
+	if len(m.ExtraMap) > 0 {
+		bs, _ := json.Marshal(m.ExtraMap)
+		m.Extra = string(bs)
+	}
+
+	m.Id = newMessageId()
+
+	enqueue(m)
+	ctx.JSON(http.StatusOK, map[string]any{"id": m.Id})
+}
+
+// renderAlerts renders the alerts into a simple message according to the sender type,
+// ie. markdown for bots and apps, html for email and incident actions for pagerduty and opsgenie
+func renderAlerts(s sender, tplName string, g *alertGroup) (m *message, err error) {
+	m = &message{
+		Title:    g.title(),
+		Simple:   true,
+		ExtraMap: make(map[string]any),
+	}
+	format := formatMarkdown
+	switch t := s.getConf()["type"]; t {
+	case "email":
+		m.MsgType, m.Simple, format = "text/html", false, formatHTML
+	case "feishuBot", "feishuApp":
+		m.MsgType = feishuInteractive
+	case "wechatBot", "wechatApp", "dingdingBot", "dingdingApp", "matrix", "mattermost", "rocketchat", "bark", "ntfy", "gotify":
+		m.MsgType = simpleMarkdown
+	case "pagerduty", "opsgenie":
+		h := md5.Sum([]byte(g.GroupKey))
+		m.MsgType, format = lo.Ternary(g.Status == alertResolved, incidentResolve, incidentTrigger), formatText
+		m.ExtraMap["dedup_key"] = hex.EncodeToString(h[:])
+		if v := g.CommonLabels["severity"]; v != "" {
+			m.ExtraMap["severity"] = v
+		}
+	default:
+		return nil, fmt.Errorf("sender type %s does not support alerts from integrations", t)
+	}
+
+	tpl := defaultAlertTemplate
+	if tplName != "" {
+		templates, err := global.GetTemplates()
+		if err != nil {
+			return nil, err
+		}
+		text, ok := templates[tplName]
+		if !ok {
+			return nil, fmt.Errorf("cannot find template with name %s", tplName)
+		}
+		if tpl, err = template.New(tplName).Funcs(alertTemplateFuncs).Parse(text); err != nil {
+			return nil, err
+		}
+	}
+	buf := &bytes.Buffer{}
+	if err = tpl.Execute(buf, g); err != nil {
+		return nil, err
+	}
+	m.Content = strings.TrimSpace(buf.String())
+	// custom templates of email are written in html already
+	if format == formatHTML && tplName == "" {
+		m.Content = markdownToHTML(m.Content)
+	}
+
+	return
+}
+
+// matchLabels returns true if all labels in match are matched, values in match are regular expressions
+func matchLabels(match map[string]string, labels map[string]string) bool {
+	for k, v := range match {
+		re, err := regexp.Compile(fmt.Sprintf("^(?:%s)$", v))
+		if err != nil || !re.MatchString(labels[k]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,186 @@
+package send
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"math/rand"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+)
+
+var (
+	mdCode   = regexp.MustCompile("`([^`]+)`")
+	mdBold   = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	mdItalic = regexp.MustCompile(`\*(.+?)\*`)
+	mdLink   = regexp.MustCompile(`\[([^\]]+)\]\(([^)]+)\)`)
+	mdHeader = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	mdUl     = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+	mdOl     = regexp.MustCompile(`^\s*\d+\.\s+(.*)$`)
+)
+
+func init() {
+	registered["matrix"] = func(conf map[string]string) sender {
+		return &matrix{conf: conf}
+	}
+}
+
+type matrix struct {
+	conf map[string]string
+}
+
+// send matrix room message, tos are room ids and the room in conf is used if tos is empty
+//
+//	https://spec.matrix.org/latest/client-server-api/#put_matrixclientv3roomsroomidsendeventtypetxnid
+//	https://spec.matrix.org/latest/client-server-api/#mroommessage-msgtypes
+func (m *matrix) send(msg *message) error {
+	if msg.Simple {
+		switch msg.MsgType {
+		case simpleText:
+			msg.ContentMap = map[string]any{
+				"msgtype": "m.text",
+				"body":    msg.Content,
+			}
+		case simpleMarkdown:
+			msg.ContentMap = map[string]any{
+				"msgtype":        "m.text",
+				"body":           msg.Content,
+				"format":         "org.matrix.custom.html",
+				"formatted_body": markdownToHTML(msg.Content),
+			}
+		default:
+			return fmt.Errorf("sender type %s does not support simple type %s", m.conf["type"], msg.MsgType)
+		}
+	}
+
+	if len(msg.Ats) > 0 {
+		switch msg.MsgType {
+		case simpleText, simpleMarkdown:
+			users := lo.Without(msg.Ats, "@all")
+			msg.ContentMap["m.mentions"] = map[string]any{
+				"user_ids": users,
+				"room":     lo.Contains(msg.Ats, "@all"),
+			}
+			msg.ContentMap["body"] = fmt.Sprintf("%v \n %s", msg.ContentMap["body"],
+				strings.Join(lo.Map(msg.Ats, func(s string, _ int) string { return lo.Ternary(s == "@all", "@room", s) }), " "))
+			if msg.MsgType == simpleMarkdown {
+				msg.ContentMap["formatted_body"] = fmt.Sprintf("%v<br>%s", msg.ContentMap["formatted_body"],
+					strings.Join(lo.Map(msg.Ats, func(s string, _ int) string {
+						if s == "@all" {
+							return "@room"
+						}
+						return fmt.Sprintf(`<a href="https://matrix.to/#/%s">%s</a>`, url.PathEscape(s), html.EscapeString(s))
+					}), " "))
+			}
+		}
+	}
+
+	rooms := lo.Ternary(len(msg.Tos) > 0, msg.Tos, []string{m.conf["room"]})
+	ids, errs := make([]string, 0), make([]string, 0)
+	for _, room := range rooms {
+		txnId := fmt.Sprintf("%d%d", time.Now().UnixNano(), rand.Int63())
+		resp, err := recordedR(msg).
+			SetAuthToken(m.conf["token"]).
+			SetBody(lo.Assign(msg.ExtraMap, msg.ContentMap)).
+			Put(getURL(m.conf, "url", "", fmt.Sprintf("/_matrix/client/v3/rooms/%s/send/m.room.message/%s", url.PathEscape(room), txnId)))
+
+		RecordResp(msg, err, resp)
+
+		if err = handleErr("send to matrix failed", err, resp, func(dt map[string]any) bool { return dt["event_id"] != nil }); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", room, err))
+			msg.failRecipient(room, err)
+			continue
+		}
+
+		dt := make(map[string]any)
+		_ = json.Unmarshal(resp.Body(), &dt)
+		ids = append(ids, cast.ToString(dt["event_id"]))
+	}
+	msg.VendorId = strings.Join(ids, ",")
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+func (m *matrix) getConf() map[string]string {
+	return m.conf
+}
+
+// markdownToHTML renders the commonly used subset of markdown, ie. headers, lists, code, bold, italic and links
+func markdownToHTML(md string) string {
+	sb := &strings.Builder{}
+	list, code := "", false
+	closeList := func() {
+		if list != "" {
+			sb.WriteString(fmt.Sprintf("</%s>", list))
+			list = ""
+		}
+	}
+	openList := func(tag string) {
+		if list != tag {
+			closeList()
+			sb.WriteString(fmt.Sprintf("<%s>", tag))
+			list = tag
+		}
+	}
+	inline := func(s string) string {
+		s = html.EscapeString(s)
+		s = mdCode.ReplaceAllString(s, "<code>$1</code>")
+		s = mdLink.ReplaceAllStringFunc(s, mdLinkToHTML)
+		s = mdBold.ReplaceAllString(s, "<strong>$1</strong>")
+		s = mdItalic.ReplaceAllString(s, "<em>$1</em>")
+		return s
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(md, "\r\n", "\n"), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			closeList()
+			sb.WriteString(lo.Ternary(code, "</code></pre>", "<pre><code>"))
+			code = !code
+			continue
+		}
+		if code {
+			sb.WriteString(html.EscapeString(line) + "\n")
+			continue
+		}
+		if ss := mdHeader.FindStringSubmatch(line); ss != nil {
+			closeList()
+			sb.WriteString(fmt.Sprintf("<h%d>%s</h%d>", len(ss[1]), inline(ss[2]), len(ss[1])))
+		} else if ss := mdUl.FindStringSubmatch(line); ss != nil {
+			openList("ul")
+			sb.WriteString(fmt.Sprintf("<li>%s</li>", inline(ss[1])))
+		} else if ss := mdOl.FindStringSubmatch(line); ss != nil {
+			openList("ol")
+			sb.WriteString(fmt.Sprintf("<li>%s</li>", inline(ss[1])))
+		} else if strings.TrimSpace(line) == "" {
+			closeList()
+		} else {
+			closeList()
+			sb.WriteString(inline(line) + "<br>")
+		}
+	}
+	closeList()
+	if code {
+		sb.WriteString("</code></pre>")
+	}
+
+	return strings.TrimSuffix(sb.String(), "<br>")
+}
+
+// mdLinkToHTML converts an escaped markdown link to an anchor, links with schemes other than http, https and mailto are kept as text
+func mdLinkToHTML(s string) string {
+	ss := mdLink.FindStringSubmatch(s)
+	u, err := url.Parse(html.UnescapeString(ss[2]))
+	if err != nil || !lo.Contains([]string{"http", "https", "mailto"}, strings.ToLower(u.Scheme)) {
+		return s
+	}
+	return fmt.Sprintf(`<a href="%s">%s</a>`, ss[2], ss[1])
+}
@@ -0,0 +1,28 @@
+package send
+
+import "testing"
+
+func TestMarkdownToHTML(t *testing.T) {
+	for _, c := range []struct {
+		name, md, want string
+	}{
+		{"link", "[grafana](https://grafana.xxx.com/d/1?a=1&b=2)", `<a href="https://grafana.xxx.com/d/1?a=1&amp;b=2">grafana</a>`},
+		{"mailto link", "[sre](mailto:sre@xxx.com)", `<a href="mailto:sre@xxx.com">sre</a>`},
+		{"javascript link", "[x](javascript:alert(1))", "[x](javascript:alert(1))"},
+		{"upper case javascript link", "[x](JavaScript:alert&#40;1&#41;)", "[x](JavaScript:alert&amp;#40;1&amp;#41;)"},
+		{"data link", "[x](data:text/html;base64,xxx)", "[x](data:text/html;base64,xxx)"},
+		{"relative link", "[x](/v1/histories)", "[x](/v1/histories)"},
+		{"quote in link", `[x](https://a.com/"onmouseover="alert(1))`, `<a href="https://a.com/&#34;onmouseover=&#34;alert(1">x</a>)`},
+		{"bold and italic", "**critical** and *warning*", "<strong>critical</strong> and <em>warning</em>"},
+		{"inline code", "run `kubectl get pods`", "run <code>kubectl get pods</code>"},
+		{"code block", "```\n<b>x</b>\n```", "<pre><code>&lt;b&gt;x&lt;/b&gt;\n</code></pre>"},
+		{"escaping", "<script>alert(1)</script> & \"x\"", "&lt;script&gt;alert(1)&lt;/script&gt; &amp; &#34;x&#34;"},
+		{"header", "## disk full", "<h2>disk full</h2>"},
+		{"lists", "- a\n- b\n\n1. c", "<ul><li>a</li><li>b</li></ul><ol><li>c</li></ol>"},
+		{"lines", "a\nb", "a<br>b"},
+	} {
+		if got := markdownToHTML(c.md); got != c.want {
+			t.Errorf("%s: markdownToHTML(%q) = %q, want %q", c.name, c.md, got, c.want)
+		}
+	}
+}
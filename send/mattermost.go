@@ -0,0 +1,97 @@
+package send
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+)
+
+func init() {
+	registered["mattermost"] = func(conf map[string]string) sender {
+		return &mattermost{conf: conf}
+	}
+}
+
+type mattermost struct {
+	conf map[string]string
+}
+
+// send mattermost message, the rest api is used with tos as channel ids if token is configured, otherwise the incoming webhook in url is used
+//
+//	https://developers.mattermost.com/integrate/webhooks/incoming/
+//	https://api.mattermost.com/#tag/posts/operation/CreatePost
+func (m *mattermost) send(msg *message) error {
+	key := lo.Ternary(m.conf["token"] != "", "message", "text")
+	if msg.Simple {
+		switch msg.MsgType {
+		case simpleText, simpleMarkdown:
+			msg.ContentMap = map[string]any{
+				key: msg.Content,
+			}
+		default:
+			return fmt.Errorf("sender type %s does not support simple type %s", m.conf["type"], msg.MsgType)
+		}
+	}
+
+	if len(msg.Ats) > 0 {
+		switch msg.MsgType {
+		case simpleText, simpleMarkdown:
+			msg.ContentMap[key] = fmt.Sprintf("%v \n %s",
+				msg.ContentMap[key],
+				strings.Join(lo.Map(msg.Ats, func(s string, _ int) string {
+					return fmt.Sprintf("@%s", strings.TrimPrefix(lo.Ternary(s == "@all", "channel", s), "@"))
+				}), " "))
+		}
+	}
+
+	if m.conf["token"] == "" {
+		resp, err := recordedR(msg).
+			SetBody(lo.Assign(msg.ExtraMap, msg.ContentMap)).
+			Post(m.conf["url"])
+
+		RecordResp(msg, err, resp)
+
+		// the webhook responds plain text ok
+		return handleErr("send to mattermost webhook failed", err, resp, func(dt map[string]any) bool { return true })
+	}
+
+	if len(msg.Tos) <= 0 {
+		return fmt.Errorf("tos is required to send with token, it is a list of channel ids")
+	}
+	ids, errs := make([]string, 0), make([]string, 0)
+	for _, channel := range msg.Tos {
+		resp, err := recordedR(msg).
+			SetAuthToken(m.conf["token"]).
+			SetBody(lo.Assign(msg.ExtraMap, msg.ContentMap, map[string]any{
+				"channel_id": channel,
+			})).
+			Post(getURL(m.conf, "baseUrl", "", "/api/v4/posts"))
+
+		RecordResp(msg, err, resp)
+
+		// posts are created with 201
+		if err = handle2xxErr("send to mattermost failed", err, resp, func(dt map[string]any) bool { return dt["id"] != nil }); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", channel, err))
+			msg.failRecipient(channel, err)
+			continue
+		}
+
+		dt := make(map[string]any)
+		_ = json.Unmarshal(resp.Body(), &dt)
+		ids = append(ids, cast.ToString(dt["id"]))
+	}
+	msg.VendorId = strings.Join(ids, ",")
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+func (m *mattermost) getConf() map[string]string {
+	return m.conf
+}
@@ -0,0 +1,97 @@
+package send
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+)
+
+const (
+	ntfyURL = "https://ntfy.sh"
+)
+
+var (
+	ntfyPriorities = map[string]int{"min": 1, "low": 2, "default": 3, "high": 4, "urgent": 5, "max": 5}
+)
+
+func init() {
+	registered["ntfy"] = func(conf map[string]string) sender {
+		return &ntfy{conf: conf}
+	}
+}
+
+type ntfy struct {
+	conf map[string]string
+}
+
+// send ntfy message, tos are topics and the topic in conf is used if tos is empty
+//
+//	https://docs.ntfy.sh/publish/#publish-as-json
+func (n *ntfy) send(msg *message) error {
+	if msg.Simple {
+		switch msg.MsgType {
+		case simpleText, simpleMarkdown:
+			msg.ContentMap = map[string]any{
+				"title":    msg.Title,
+				"message":  msg.Content,
+				"markdown": msg.MsgType == simpleMarkdown,
+			}
+		default:
+			return fmt.Errorf("sender type %s does not support simple type %s", n.conf["type"], msg.MsgType)
+		}
+	}
+
+	body := lo.OmitByKeys(lo.Assign(msg.ExtraMap, msg.ContentMap), []string{"level"})
+	for _, k := range []string{"level", "priority"} {
+		v, ok := msg.ExtraMap[k]
+		if !ok {
+			continue
+		}
+		body["priority"] = lo.Ternary(ntfyPriorities[cast.ToString(v)] > 0, ntfyPriorities[cast.ToString(v)], cast.ToInt(v))
+	}
+	if v, ok := msg.ExtraMap["url"]; ok {
+		delete(body, "url")
+		body["click"] = v
+	}
+
+	topics := lo.Ternary(len(msg.Tos) > 0, msg.Tos, []string{n.conf["topic"]})
+	ids, errs := make([]string, 0), make([]string, 0)
+	for _, topic := range topics {
+		r := recordedR(msg).
+			SetBody(lo.Assign(body, map[string]any{
+				"topic": topic,
+			}))
+		if n.conf["token"] != "" {
+			r.SetAuthToken(n.conf["token"])
+		} else if n.conf["username"] != "" {
+			r.SetBasicAuth(n.conf["username"], n.conf["password"])
+		}
+		resp, err := r.Post(getURL(n.conf, "url", ntfyURL, ""))
+
+		RecordResp(msg, err, resp)
+
+		if err = handleErr("send to ntfy failed", err, resp, func(dt map[string]any) bool { return dt["id"] != nil }); err != nil {
+			errs = append(errs, err.Error())
+			msg.failRecipient(topic, err)
+			continue
+		}
+
+		dt := make(map[string]any)
+		_ = json.Unmarshal(resp.Body(), &dt)
+		ids = append(ids, cast.ToString(dt["id"]))
+	}
+	msg.VendorId = strings.Join(ids, ",")
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+func (n *ntfy) getConf() map[string]string {
+	return n.conf
+}
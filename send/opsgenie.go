@@ -0,0 +1,91 @@
+package send
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+)
+
+const (
+	opsgenieURL = "https://api.opsgenie.com"
+)
+
+var (
+	opsgeniePriorities = map[string]string{"critical": "P1", "error": "P2", "warning": "P3", "info": "P5"}
+)
+
+func init() {
+	registered["opsgenie"] = func(conf map[string]string) sender {
+		return &opsgenie{conf: conf}
+	}
+}
+
+type opsgenie struct {
+	conf map[string]string
+}
+
+// send opsgenie alert, msgtype is the action, ie. trigger(create), acknowledge or resolve(close)
+//
+//	https://docs.opsgenie.com/docs/alert-api
+func (o *opsgenie) send(msg *message) (err error) {
+	alias, err := incidentKey(msg, "alias", "dedup_key")
+	if err != nil {
+		return
+	}
+
+	path, body := "", map[string]any{
+		"source": lo.Ternary(o.conf["source"] != "", o.conf["source"], "messenger"),
+	}
+	switch msg.MsgType {
+	case incidentTrigger:
+		summary := lo.Ternary(msg.Title != "", msg.Title, msg.Content)
+		// opsgenie creates alerts asynchronously, so the alias is generated here to be able to close it later
+		if alias == "" {
+			h := md5.Sum([]byte(msg.Sender + summary))
+			alias = hex.EncodeToString(h[:])
+		}
+		path = "/v2/alerts"
+		body = lo.Assign(body, map[string]any{
+			"message":     lo.Substring(summary, 0, 130),
+			"alias":       alias,
+			"description": msg.Content,
+			"priority":    lo.Ternary(opsgeniePriorities[cast.ToString(msg.ExtraMap["severity"])] != "", opsgeniePriorities[cast.ToString(msg.ExtraMap["severity"])], "P3"),
+			"details":     lo.MapValues(cast.ToStringMap(msg.ExtraMap["details"]), func(v any, _ string) string { return cast.ToString(v) }),
+		}, msg.ContentMap)
+	case incidentAcknowledge, incidentResolve:
+		if alias == "" {
+			return fmt.Errorf("alias, dedup_key or history_id in extra is required to %s an opsgenie alert", msg.MsgType)
+		}
+		path = fmt.Sprintf("/v2/alerts/%s/%s", url.PathEscape(alias), lo.Ternary(msg.MsgType == incidentResolve, "close", "acknowledge"))
+		body["note"] = msg.Content
+	default:
+		return fmt.Errorf("sender type %s does not support message type %s", o.conf["type"], msg.MsgType)
+	}
+
+	r := recordedR(msg).
+		SetHeader("Authorization", fmt.Sprintf("GenieKey %s", o.conf["apiKey"])).
+		SetBody(body)
+	if msg.MsgType != incidentTrigger {
+		r.SetQueryParam("identifierType", "alias")
+	}
+	resp, err := r.Post(getURL(o.conf, "baseUrl", opsgenieURL, path))
+
+	RecordResp(msg, err, resp)
+
+	// requests are processed asynchronously and accepted with 202
+	if err = handle2xxErr("send to opsgenie failed", err, resp, func(dt map[string]any) bool { return dt["result"] != nil }); err != nil {
+		return
+	}
+
+	msg.VendorId = alias
+
+	return
+}
+
+func (o *opsgenie) getConf() map[string]string {
+	return o.conf
+}
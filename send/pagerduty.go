@@ -0,0 +1,91 @@
+package send
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+)
+
+const (
+	pagerdutyURL = "https://events.pagerduty.com"
+
+	incidentTrigger     = "trigger"
+	incidentAcknowledge = "acknowledge"
+	incidentResolve     = "resolve"
+)
+
+func init() {
+	registered["pagerduty"] = func(conf map[string]string) sender {
+		return &pagerduty{conf: conf}
+	}
+}
+
+type pagerduty struct {
+	conf map[string]string
+}
+
+// send pagerduty event, msgtype is the event action, ie. trigger, acknowledge or resolve
+//
+//	https://developer.pagerduty.com/api-reference/368ae3d938c9e-send-an-event-to-pager-duty
+func (p *pagerduty) send(msg *message) (err error) {
+	if !lo.Contains([]string{incidentTrigger, incidentAcknowledge, incidentResolve}, msg.MsgType) {
+		return fmt.Errorf("sender type %s does not support message type %s", p.conf["type"], msg.MsgType)
+	}
+	dedupKey, err := incidentKey(msg, "dedup_key")
+	if err != nil {
+		return
+	}
+
+	body := map[string]any{
+		"routing_key":  p.conf["routingKey"],
+		"event_action": msg.MsgType,
+	}
+	if dedupKey != "" {
+		body["dedup_key"] = dedupKey
+	}
+	if msg.MsgType == incidentTrigger {
+		body["payload"] = lo.Assign(map[string]any{
+			"summary":        lo.Ternary(msg.Title != "", msg.Title, msg.Content),
+			"source":         lo.Ternary(p.conf["source"] != "", p.conf["source"], "messenger"),
+			"severity":       lo.Ternary(cast.ToString(msg.ExtraMap["severity"]) != "", cast.ToString(msg.ExtraMap["severity"]), "error"),
+			"custom_details": lo.Ternary(msg.ExtraMap["details"] != nil, msg.ExtraMap["details"], any(msg.Content)),
+		}, msg.ContentMap)
+	}
+
+	resp, err := recordedR(msg).
+		SetBody(body).
+		Post(getURL(p.conf, "baseUrl", pagerdutyURL, "/v2/enqueue"))
+
+	RecordResp(msg, err, resp)
+
+	// events are accepted with 202
+	if err = handle2xxErr("send to pagerduty failed", err, resp, func(dt map[string]any) bool { return dt["status"] == "success" }); err != nil {
+		return
+	}
+
+	dt := make(map[string]any)
+	_ = json.Unmarshal(resp.Body(), &dt)
+	msg.VendorId = cast.ToString(dt["dedup_key"])
+
+	return
+}
+
+func (p *pagerduty) getConf() map[string]string {
+	return p.conf
+}
+
+// incidentKey returns the first non-empty value of keys in extra,
+// or the vendor id recorded by the message whose history id is history_id in extra
+func incidentKey(msg *message, keys ...string) (string, error) {
+	for _, k := range keys {
+		if v := cast.ToString(msg.ExtraMap[k]); v != "" {
+			return v, nil
+		}
+	}
+	if v, ok := msg.ExtraMap["history_id"]; ok {
+		return getVendorId(msg.Tenant, cast.ToInt(v))
+	}
+	return "", nil
+}
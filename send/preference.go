@@ -0,0 +1,342 @@
+package send
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/veops/messenger/global"
+)
+
+const (
+	recipientSuppressed = "suppressed"
+
+	severityCritical = "critical"
+)
+
+var (
+	// severityLevels are the common severities, unknown severities are regarded as critical and never suppressed
+	severityLevels = map[string]int{
+		"info":           0,
+		"warning":        1,
+		"error":          2,
+		severityCritical: 3,
+	}
+)
+
+// Preference is the notification preference of a contact, it only applies to recipients referenced by contact: or group:
+type Preference struct {
+	Id      int    `gorm:"column:id" json:"id"`
+	Tenant  string `gorm:"column:tenant;uniqueIndex:idx_preference_tenant_contact;default:''" json:"-"`
+	Contact string `gorm:"column:contact;uniqueIndex:idx_preference_tenant_contact" json:"contact" validate:"required" example:"alice"`
+	// Channels are the allowed sender names or types, all senders are allowed if it is empty
+	Channels []string `gorm:"column:channels;serializer:json" json:"channels" validate:"optional" example:"email"`
+	// QuietStart and QuietEnd are local time in format 15:04, messages which are not critical are suppressed between them
+	QuietStart   string   `gorm:"column:quiet_start" json:"quiet_start" validate:"optional" example:"22:00"`
+	QuietEnd     string   `gorm:"column:quiet_end" json:"quiet_end" validate:"optional" example:"08:00"`
+	MinSeverity  string   `gorm:"column:min_severity" json:"min_severity" validate:"optional" example:"warning"`
+	Unsubscribed []string `gorm:"column:unsubscribed;serializer:json" json:"unsubscribed" validate:"optional" example:"marketing"`
+	UpdatedAt    int64    `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (Preference) TableName() string {
+	return "preference"
+}
+
+// suppressReason returns why msg should not be sent with sender s by the preference, it is empty if msg is allowed
+func (p *Preference) suppressReason(s sender, msg *message) string {
+	conf := s.getConf()
+	level, ok := severityLevels[lo.Ternary(msg.Severity != "", msg.Severity, "info")]
+	if !ok {
+		level = severityLevels[severityCritical]
+	}
+	switch {
+	case msg.Category != "" && lo.Contains(p.Unsubscribed, msg.Category):
+		return fmt.Sprintf("category %s is unsubscribed", msg.Category)
+	case p.MinSeverity != "" && level < severityLevels[p.MinSeverity]:
+		return fmt.Sprintf("severity is lower than %s", p.MinSeverity)
+	case level < severityLevels[severityCritical] && p.inQuietHours(time.Now()):
+		return "in quiet hours"
+	case len(p.Channels) > 0 && !lo.Contains(p.Channels, conf["name"]) && !lo.Contains(p.Channels, conf["type"]):
+		return fmt.Sprintf("sender %s is not allowed", conf["name"])
+	}
+	return ""
+}
+
+func (p *Preference) inQuietHours(t time.Time) bool {
+	start, err1 := time.ParseInLocation("15:04", p.QuietStart, time.Local)
+	end, err2 := time.ParseInLocation("15:04", p.QuietEnd, time.Local)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	now, s, e := t.Hour()*60+t.Minute(), start.Hour()*60+start.Minute(), end.Hour()*60+end.Minute()
+	// quiet hours may cross midnight, eg. 22:00 to 08:00
+	return lo.Ternary(s <= e, now >= s && now < e, now >= s || now < e)
+}
+
+// reroute sends a copy of msg to the contact with the first allowed sender, only simple text, markdown and plain text email are rerouted
+func (p *Preference) reroute(msg *message) (*message, bool) {
+	if !(msg.Simple && lo.Contains([]string{simpleText, simpleMarkdown}, msg.MsgType)) && msg.MsgType != "text/plain" {
+		return nil, false
+	}
+	for _, name := range p.Channels {
+		s, ok := getSender(msg.Tenant, name)
+		if !ok || name == msg.Sender {
+			continue
+		}
+		m := &message{
+			Id:         newMessageId(),
+			Sender:     name,
+			Tenant:     msg.Tenant,
+			Title:      msg.Title,
+			Content:    msg.Content,
+			Tos:        []string{contactPrefix + p.Contact},
+			Category:   msg.Category,
+			Severity:   msg.Severity,
+			ReceivedAt: msg.ReceivedAt,
+		}
+		switch t := s.getConf()["type"]; t {
+		case "email":
+			m.MsgType = "text/plain"
+		case "wechatApp", "feishuApp", "dingdingApp", "matrix", "mattermost", "rocketchat", "bark", "ntfy", "gotify":
+			m.MsgType, m.Simple = simpleText, true
+		default:
+			continue
+		}
+		if p.suppressReason(s, m) != "" {
+			continue
+		}
+		return m, true
+	}
+	return nil, false
+}
+
+// suppressed returns true if all recipients of msg are suppressed by preferences so that it is not sent
+func (m *message) suppressed() bool {
+	return len(m.Tos) == 0 && len(m.Recipients) > 0 && lo.EveryBy(m.Recipients, func(r *Recipient) bool { return r.Status == recipientSuppressed })
+}
+
+// filterByPreference returns false if contact c should not receive msg with sender s, the recipient is recorded as suppressed,
+// and it is rerouted to another allowed sender if possible
+func filterByPreference(s sender, msg *message, c *Contact) bool {
+	p := &Preference{}
+	if err := db.Where("tenant = ? AND contact = ?", c.Tenant, c.Name).Limit(1).Find(p).Error; err != nil || p.Id == 0 {
+		return true
+	}
+	reason := p.suppressReason(s, msg)
+	if reason == "" {
+		return true
+	}
+	if m, ok := p.reroute(msg); ok {
+		reason = fmt.Sprintf("%s, rerouted to %s with message id %s", reason, m.Sender, m.Id)
+		go enqueue(m)
+	}
+	msg.Recipients = append(msg.Recipients, &Recipient{Recipient: contactPrefix + c.Name, Status: recipientSuppressed, Err: reason})
+	return false
+}
+
+// QueryPreference
+//
+//	@Tags			contact
+//	@Description	query notification preferences
+//	@Param			page_index	query		int		true	"page_index"
+//	@Param			page_size	query		int		true	"page_size"
+//	@Param			contact		query		string	false	"contact name"
+//	@Success		200			{object}	map[string]any
+//	@Router			/v1/preferences [GET]
+func QueryPreference(ctx *gin.Context) {
+	q := db.Model(&Preference{})
+	if v := ctx.Query("contact"); v != "" {
+		q = q.Where("contact = ?", v)
+	}
+	preferences := make([]*Preference, 0)
+	queryRows(ctx, q, &preferences)
+}
+
+// SetPreference
+//
+//	@Tags			contact
+//	@Description	set the notification preference of a contact, the existing one is replaced
+//	@Accept			json
+//	@Produce		json
+//	@Param			contact	path		string				true	"contact name"
+//	@Param			body	body		Preference			true	" "
+//	@Success		200		{object}	map[string]any		"a map with msg info and the preference"
+//	@Router			/v1/preferences/{contact} [PUT]
+func SetPreference(ctx *gin.Context) {
+	p := &Preference{}
+	if err := ctx.ShouldBindBodyWith(p, binding.JSON); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	p.Id, p.Tenant, p.Contact, p.UpdatedAt = 0, tenantOf(ctx), ctx.Param("contact"), time.Now().Unix()
+	if err := checkPreference(p); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	if err := savePreference(db, p); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, map[string]any{"preference": p})
+}
+
+// DeletePreference
+//
+//	@Tags			contact
+//	@Description	delete the notification preference of a contact, all messages are allowed then
+//	@Param			contact	path		string				true	"contact name"
+//	@Success		200		{object}	map[string]string	"a map with msg info, eg. {msg:ok}"
+//	@Router			/v1/preferences/{contact} [DELETE]
+func DeletePreference(ctx *gin.Context) {
+	if err := db.Where("tenant = ? AND contact = ?", tenantOf(ctx), ctx.Param("contact")).Delete(&Preference{}).Error; err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, map[string]any{})
+}
+
+// unsubscribeForm is the confirmation page of unsubscription links, links in emails may be opened by scanners of mail servers,
+// so only POST unsubscribes
+const unsubscribeForm = `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>退订</title></head>
+<body>
+<form method="post" action="%s">
+<p>确认退订%s类消息？</p>
+<button type="submit">退订</button>
+</form>
+</body>
+</html>`
+
+// UnsubscribeForm
+//
+//	@Tags			contact
+//	@Description	show the confirmation page of the unsubscription link in emails, it posts to the same link to unsubscribe
+//	@Produce		html
+//	@Param			tenant		query	string	false	"tenant name of the contact"
+//	@Param			contact		query	string	true	"contact name"
+//	@Param			category	query	string	true	"message category"
+//	@Param			token		query	string	true	"token signed with unsubscribeSecret in app conf"
+//	@Success		200
+//	@Router			/v1/unsubscribe [GET]
+func UnsubscribeForm(ctx *gin.Context) {
+	if _, _, category, ok := checkUnsubscribe(ctx); ok {
+		ctx.Data(http.StatusOK, "text/html; charset=utf-8",
+			[]byte(fmt.Sprintf(unsubscribeForm, html.EscapeString(ctx.Request.URL.RequestURI()), html.EscapeString(category))))
+	}
+}
+
+// Unsubscribe
+//
+//	@Tags			contact
+//	@Description	unsubscribe a category of messages with the link in emails, it is also the one-click unsubscription of RFC 8058
+//	@Param			tenant		query	string	false	"tenant name of the contact"
+//	@Param			contact		query	string	true	"contact name"
+//	@Param			category	query	string	true	"message category"
+//	@Param			token		query	string	true	"token signed with unsubscribeSecret in app conf"
+//	@Success		200
+//	@Router			/v1/unsubscribe [POST]
+func Unsubscribe(ctx *gin.Context) {
+	tenant, contact, category, ok := checkUnsubscribe(ctx)
+	if !ok {
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		p := &Preference{}
+		if err := tx.Where("tenant = ? AND contact = ?", tenant, contact).Limit(1).Find(p).Error; err != nil {
+			return err
+		}
+		p.Tenant, p.Contact, p.Unsubscribed, p.UpdatedAt = tenant, contact, lo.Uniq(append(p.Unsubscribed, category)), time.Now().Unix()
+		return savePreference(tx, p)
+	})
+	if err != nil {
+		log.Printf("unsubscribe %s of contact %s failed, err=%v", category, contact, err)
+		ctx.String(http.StatusInternalServerError, "unsubscribe failed")
+		return
+	}
+
+	ctx.String(http.StatusOK, "已退订%s类消息", category)
+}
+
+// checkUnsubscribe verifies the token of unsubscription link, it responds 403 if the link is invalid
+func checkUnsubscribe(ctx *gin.Context) (tenant, contact, category string, ok bool) {
+	tenant, contact, category = ctx.Query("tenant"), ctx.Query("contact"), ctx.Query("category")
+	secret := appConfOf("unsubscribeSecret")
+	if secret == "" || contact == "" || category == "" || !hmac.Equal([]byte(ctx.Query("token")), []byte(unsubscribeToken(secret, tenant, contact, category))) {
+		ctx.String(http.StatusForbidden, "invalid unsubscription link")
+		return
+	}
+	return tenant, contact, category, true
+}
+
+func checkPreference(p *Preference) error {
+	if err := db.Where("tenant = ? AND name = ?", p.Tenant, p.Contact).First(&Contact{}).Error; err != nil {
+		return fmt.Errorf("cannot find contact %s, err=%w", p.Contact, err)
+	}
+	if p.MinSeverity != "" {
+		if _, ok := severityLevels[p.MinSeverity]; !ok {
+			return fmt.Errorf("invalid min_severity %s, it should be one of %s", p.MinSeverity, strings.Join(lo.Keys(severityLevels), ","))
+		}
+	}
+	for _, v := range []string{p.QuietStart, p.QuietEnd} {
+		if _, err := time.Parse("15:04", v); v != "" && err != nil {
+			return fmt.Errorf("invalid quiet hours %s, it should be in format 15:04", v)
+		}
+	}
+	return nil
+}
+
+func savePreference(tx *gorm.DB, p *Preference) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "tenant"}, {Name: "contact"}},
+		DoUpdates: clause.AssignmentColumns([]string{"channels", "quiet_start", "quiet_end", "min_severity", "unsubscribed", "updated_at"}),
+	}).Create(p).Error
+}
+
+// unsubscribeToken is the hex of hmac sha256 of tenant, contact and category
+func unsubscribeToken(secret, tenant, contact, category string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte(tenant + "\n" + contact + "\n" + category))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// unsubscribeURL returns the unsubscription link of the contact of tenant whose email is addr, it is empty if unsubscription is not configured
+func unsubscribeURL(tenant, addr, category string) string {
+	base, secret := appConfOf("externalUrl"), appConfOf("unsubscribeSecret")
+	if base == "" || secret == "" || category == "" {
+		return ""
+	}
+	c := &Contact{}
+	if err := db.Where("tenant = ? AND email = ?", tenant, addr).Limit(1).Find(c).Error; err != nil || c.Id == 0 {
+		return ""
+	}
+	q := url.Values{"contact": {c.Name}, "category": {category}, "token": {unsubscribeToken(secret, tenant, c.Name, category)}}
+	if tenant != "" {
+		q.Set("tenant", tenant)
+	}
+	return fmt.Sprintf("%s/v1/unsubscribe?%s", strings.TrimSuffix(base, "/"), q.Encode())
+}
+
+func appConfOf(key string) string {
+	conf, err := global.GetAppConf()
+	if err != nil {
+		return ""
+	}
+	return conf[key]
+}
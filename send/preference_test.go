@@ -0,0 +1,76 @@
+package send
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInQuietHours(t *testing.T) {
+	at := func(hm string) time.Time {
+		v, _ := time.ParseInLocation("15:04", hm, time.Local)
+		return v
+	}
+	for _, c := range []struct {
+		start, end, now string
+		want            bool
+	}{
+		{"12:00", "14:00", "11:59", false},
+		{"12:00", "14:00", "12:00", true},
+		{"12:00", "14:00", "13:59", true},
+		{"12:00", "14:00", "14:00", false},
+		// crossing midnight
+		{"22:00", "08:00", "21:59", false},
+		{"22:00", "08:00", "22:00", true},
+		{"22:00", "08:00", "23:59", true},
+		{"22:00", "08:00", "00:00", true},
+		{"22:00", "08:00", "07:59", true},
+		{"22:00", "08:00", "08:00", false},
+		{"22:00", "08:00", "12:00", false},
+		// not configured or invalid
+		{"", "", "12:00", false},
+		{"22:00", "", "23:00", false},
+		{"25:00", "08:00", "23:00", false},
+	} {
+		p := &Preference{QuietStart: c.start, QuietEnd: c.end}
+		if got := p.inQuietHours(at(c.now)); got != c.want {
+			t.Errorf("inQuietHours(%s-%s, %s) = %v, want %v", c.start, c.end, c.now, got, c.want)
+		}
+	}
+}
+
+func TestSuppressReason(t *testing.T) {
+	s := &email{conf: map[string]string{"name": "mail", "type": "email"}}
+	now := time.Now()
+	// quiet hours around now, it may cross midnight
+	quietStart, quietEnd := now.Add(-time.Hour).Format("15:04"), now.Add(time.Hour).Format("15:04")
+	all := Preference{
+		Channels:     []string{"sms"},
+		QuietStart:   quietStart,
+		QuietEnd:     quietEnd,
+		MinSeverity:  "error",
+		Unsubscribed: []string{"marketing"},
+	}
+	for _, c := range []struct {
+		name string
+		p    func(p *Preference)
+		msg  *message
+		want string
+	}{
+		{"unsubscribed first", nil, &message{Category: "marketing"}, "category marketing is unsubscribed"},
+		{"then severity", nil, &message{Category: "ops", Severity: "warning"}, "severity is lower than error"},
+		{"then quiet hours", nil, &message{Severity: "error"}, "in quiet hours"},
+		{"critical ignores quiet hours", nil, &message{Severity: severityCritical}, "sender mail is not allowed"},
+		{"unknown severity is critical", nil, &message{Severity: "fatal"}, "sender mail is not allowed"},
+		{"channel by type", func(p *Preference) { p.Channels = []string{"email"} }, &message{Severity: severityCritical}, ""},
+		{"channel by name", func(p *Preference) { p.Channels = []string{"mail"} }, &message{Severity: severityCritical}, ""},
+		{"no preference", func(p *Preference) { *p = Preference{} }, &message{Category: "marketing"}, ""},
+	} {
+		p := all
+		if c.p != nil {
+			c.p(&p)
+		}
+		if got := p.suppressReason(s, c.msg); got != c.want {
+			t.Errorf("%s: suppressReason = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package send
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/spf13/cast"
+)
+
+type messageUpdater interface {
+	sender
+	update(*History, *message, *message) error
+}
+
+type messageRecaller interface {
+	sender
+	recall(*History, *message) error
+}
+
+type updateMessageReq struct {
+	MsgType string `json:"msgtype" validate:"required" example:"interactive"`
+	Content string `json:"content" validate:"required" example:"this is a new content"`
+	Title   string `json:"title" validate:"optional" example:""`
+	Extra   string `json:"extra" validate:"optional" example:""`
+	Simple  bool   `json:"simple" validate:"optional" example:"true"`
+}
+
+// UpdateMessage
+//
+//	@Tags			send
+//	@Description	update a sent message with its vendor message id recorded in history, eg. feishuApp card and wechatApp template card
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string				true	"message id returned by sending, or history id"
+//	@Param			body	body		updateMessageReq	true	" "
+//	@Success		200		{object}	map[string]string	"a map with msg info, eg. {msg:ok}"
+//	@Router			/v1/message/{id} [PATCH]
+func UpdateMessage(ctx *gin.Context) {
+	r := &updateMessageReq{}
+	if err := ctx.ShouldBindBodyWith(&r, binding.JSON); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	h, origin, s, err := loadSentMessage(tenantOf(ctx), ctx.Param("id"))
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	su, ok := s.(messageUpdater)
+	if !ok || su == nil {
+		ctx.AbortWithError(http.StatusBadRequest, fmt.Errorf("sender with name %s and type %s does not support to update message", origin.Sender, s.getConf()["type"]))
+		return
+	}
+
+	m := &message{
+		Sender:  origin.Sender,
+		Tenant:  origin.Tenant,
+		MsgType: r.MsgType,
+		Content: r.Content,
+		Title:   r.Title,
+		Extra:   r.Extra,
+		Simple:  r.Simple,
+	}
+	if err = parseMessage(m); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	if err = su.update(h, origin, m); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+}
+
+// RecallMessage
+//
+//	@Tags			send
+//	@Description	recall a sent message with its vendor message id recorded in history, eg. feishuApp wechatApp and dingdingApp
+//	@Produce		json
+//	@Param			id	path		string				true	"message id returned by sending, or history id"
+//	@Success		200	{object}	map[string]string	"a map with msg info, eg. {msg:ok}"
+//	@Router			/v1/message/{id} [DELETE]
+func RecallMessage(ctx *gin.Context) {
+	h, origin, s, err := loadSentMessage(tenantOf(ctx), ctx.Param("id"))
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	sr, ok := s.(messageRecaller)
+	if !ok || sr == nil {
+		ctx.AbortWithError(http.StatusBadRequest, fmt.Errorf("sender with name %s and type %s does not support to recall message", origin.Sender, s.getConf()["type"]))
+		return
+	}
+
+	if err = sr.recall(h, origin); err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+}
+
+// loadSentMessage returns the history of the message with id, its message and the sender which sent it,
+// id is the message id returned by sending, the history id is also accepted
+func loadSentMessage(tenant string, id string) (h *History, m *message, s sender, err error) {
+	h = &History{}
+	if err = db.Model(&History{}).Where("message_id = ? AND tenant = ?", id, tenant).Order("id DESC").Limit(1).Find(h).Error; err != nil {
+		return
+	}
+	if hid, e := cast.ToIntE(id); h.Id == 0 && e == nil {
+		err = db.Model(&History{}).Where("id = ? AND tenant = ?", hid, tenant).Limit(1).Find(h).Error
+	}
+	if err != nil || h.Id == 0 {
+		err = fmt.Errorf("cannot find history of message with id %s, err=%v", id, err)
+		return
+	}
+	if h.VendorId == "" {
+		err = fmt.Errorf("history of message with id %s does not have a vendor message id", id)
+		return
+	}
+
+	m = &message{Tenant: tenant}
+	if err = json.Unmarshal([]byte(h.Message), m); err != nil {
+		return
+	}
+	if err = parseMessage(m); err != nil {
+		return
+	}
+
+	s, ok := getSender(tenant, m.Sender)
+	if !ok {
+		err = fmt.Errorf("cannot find sender with name %s", m.Sender)
+	}
+
+	return
+}
+
+// historyRespBody returns the vendor response body recorded by RecordResp
+func historyRespBody(h *History) map[string]any {
+	resp, dt := make(map[string]any), make(map[string]any)
+	_ = json.Unmarshal([]byte(h.Resp), &resp)
+	_ = json.Unmarshal([]byte(cast.ToString(resp["body"])), &dt)
+	return dt
+}
@@ -0,0 +1,35 @@
+package send
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/cast"
+)
+
+func TestLoadSentMessage(t *testing.T) {
+	h1 := &History{MessageId: newMessageId(), Tenant: "recall", VendorId: "v1", Message: `{"sender":"nosuch","msgtype":"text","content":"{}"}`}
+	h2 := &History{MessageId: newMessageId(), Tenant: "recall", Message: `{"sender":"nosuch","msgtype":"text","content":"{}"}`}
+	if err := db.Create([]*History{h1, h2}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{h1.MessageId, cast.ToString(h1.Id)} {
+		h, _, _, err := loadSentMessage("recall", id)
+		if h == nil || h.Id != h1.Id || err == nil || !strings.Contains(err.Error(), "cannot find sender") {
+			t.Errorf("loadSentMessage(%s) = %+v %v", id, h, err)
+		}
+	}
+	for id, want := range map[string]string{
+		h2.MessageId:             "does not have a vendor message id",
+		"nosuch":                 "cannot find history",
+		cast.ToString(h1.Id + 2): "cannot find history",
+	} {
+		if _, _, _, err := loadSentMessage("recall", id); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("loadSentMessage(%s) err = %v, want %s", id, err, want)
+		}
+	}
+	if _, _, _, err := loadSentMessage("", h1.MessageId); err == nil || !strings.Contains(err.Error(), "cannot find history") {
+		t.Errorf("message of other tenant is loaded, err = %v", err)
+	}
+}
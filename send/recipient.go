@@ -0,0 +1,127 @@
+package send
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+const (
+	recipientPending   = "pending"
+	recipientSent      = "sent"
+	recipientDelivered = "delivered"
+	recipientFailed    = "failed"
+
+	pollInterval = time.Minute
+	// carriers report the delivery receipts within 72 hours
+	pollTimeout = time.Hour * 72
+)
+
+// receiptPoller is implemented by senders whose delivery results are reported asynchronously, eg. aliSms
+type receiptPoller interface {
+	sender
+	// poll queries the delivery receipts of pending recipients of history and updates them
+	poll(h *History, rs []*Recipient) error
+}
+
+type Recipient struct {
+	Id        int    `gorm:"column:id" json:"id"`
+	HistoryId int    `gorm:"column:history_id;index" json:"history_id"`
+	Recipient string `gorm:"column:recipient" json:"recipient"`
+	Status    string `gorm:"column:status;index" json:"status"`
+	Err       string `gorm:"column:err" json:"err"`
+	UpdatedAt int64  `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (Recipient) TableName() string {
+	return "recipient"
+}
+
+func (r *Recipient) update(status, err string) error {
+	r.Status, r.Err = status, err
+	return db.Model(r).Updates(map[string]any{"status": status, "err": err, "updated_at": time.Now().Unix()}).Error
+}
+
+func newRecipients(tos []string, status string) []*Recipient {
+	return lo.Map(tos, func(to string, _ int) *Recipient { return &Recipient{Recipient: to, Status: status} })
+}
+
+// failRecipient records the recipient as failed, the other recipients in tos are regarded as sent
+func (m *message) failRecipient(to string, err any) {
+	m.Recipients = append(m.Recipients, &Recipient{Recipient: to, Status: recipientFailed, Err: fmt.Sprint(err)})
+}
+
+// fillRecipients fills the recipients in tos which are not recorded by sender,
+// they are sent if the message is sent or only some of the recipients failed, otherwise they failed with the error of message
+func fillRecipients(msg *message) {
+	partial := lo.SomeBy(msg.Recipients, func(r *Recipient) bool { return r.Status != recipientSuppressed })
+	recorded := lo.SliceToMap(msg.Recipients, func(r *Recipient) (string, bool) { return r.Recipient, true })
+	for _, to := range lo.Uniq(msg.Tos) {
+		if recorded[to] {
+			continue
+		}
+		r := &Recipient{Recipient: to, Status: recipientSent}
+		if msg.Err != nil && !partial {
+			r.Status, r.Err = recipientFailed, msg.Err.Error()
+		}
+		msg.Recipients = append(msg.Recipients, r)
+	}
+}
+
+// recipientOf returns the one in tos which is the same as id or its suffix, eg. 13xxx for +8613xxx
+func recipientOf(tos []string, id string) string {
+	for _, to := range tos {
+		if to != "" && strings.HasSuffix(id, to) {
+			return to
+		}
+	}
+	return id
+}
+
+// StartPoller polls the delivery receipts of pending recipients periodically
+func StartPoller() error {
+	for range time.Tick(pollInterval) {
+		pollReceipts()
+	}
+	return nil
+}
+
+func pollReceipts() {
+	rs := make([]*Recipient, 0)
+	if err := db.Where("status = ?", recipientPending).Find(&rs).Error; err != nil {
+		log.Printf("query pending recipients failed, err=%v", err)
+		return
+	}
+
+	for hid, rs := range lo.GroupBy(rs, func(r *Recipient) int { return r.HistoryId }) {
+		h := &History{}
+		if err := db.Model(&History{}).Where("id = ?", hid).First(h).Error; err != nil {
+			log.Printf("cannot find history with id %d, err=%v", hid, err)
+			continue
+		}
+		if time.Since(time.Unix(h.CreatedAt, 0)) > pollTimeout {
+			for _, r := range rs {
+				r.update(recipientFailed, "no delivery receipt received in time")
+			}
+			continue
+		}
+
+		m := &message{}
+		_ = json.Unmarshal([]byte(h.Message), m)
+		s, ok := getSender(h.Tenant, m.Sender)
+		if !ok {
+			continue
+		}
+		p, ok := s.(receiptPoller)
+		if !ok || p == nil {
+			continue
+		}
+		if err := p.poll(h, rs); err != nil {
+			log.Printf("poll delivery receipts of history %d failed, err=%v", hid, err)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package send
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -29,7 +30,7 @@ func init() {
 	if err != nil {
 		log.Fatalf("init sqlite failed, err=%v", err)
 	}
-	err = db.AutoMigrate(History{})
+	err = db.AutoMigrate(History{}, Callback{}, Recipient{}, Contact{}, Group{}, UID{}, Preference{})
 	if err != nil {
 		log.Fatalf("migrate failed, err=%v", err)
 	}
@@ -37,13 +38,19 @@ func init() {
 
 type History struct {
 	Id         int    `gorm:"column:id" json:"id"`
+	MessageId  string `gorm:"column:message_id;index" json:"message_id"`
+	Tenant     string `gorm:"column:tenant;index;default:''" json:"tenant"`
 	Message    string `gorm:"column:message" json:"message"`
 	Err        string `gorm:"column:err" json:"err"`
+	Warn       string `gorm:"column:warn" json:"warn"`
 	Req        string `gorm:"column:req" json:"req"`
 	Resp       string `gorm:"column:resp" json:"resp"`
 	Status     bool   `gorm:"column:status" json:"status"`
+	VendorId   string `gorm:"column:vendor_id" json:"vendor_id"`
 	ReceivedAt int64  `gorm:"column:received_at" json:"received_at"`
 	CreatedAt  int64  `gorm:"column:created_at" json:"created_at"`
+
+	Recipients []*Recipient `gorm:"foreignKey:HistoryId" json:"recipients"`
 }
 
 func (History) TableName() string {
@@ -51,39 +58,62 @@ func (History) TableName() string {
 }
 
 func AddHistory(msg *message) {
-	bs, _ := json.Marshal(msg)
+	// attachments are recorded without base64 content which may be tens of MB
+	m := *msg
+	m.Attachments = lo.Map(msg.Attachments, func(a *attachment, _ int) *attachment {
+		return &attachment{Name: a.Name, Url: a.Url, Path: a.Path}
+	})
+	bs, _ := json.Marshal(&m)
 	err := ""
 	if msg.Err != nil {
 		err = msg.Err.Error()
 	}
-	if err := db.Create(&History{
+	h := &History{
+		MessageId:  msg.Id,
+		Tenant:     msg.Tenant,
 		Message:    string(bs),
 		Err:        err,
+		Warn:       msg.Warn,
 		Req:        msg.Req,
 		Resp:       msg.Resp,
 		Status:     msg.Err == nil,
+		VendorId:   msg.VendorId,
 		ReceivedAt: msg.ReceivedAt,
-	}).Error; err != nil {
+		Recipients: msg.Recipients,
+	}
+	if err := db.Create(h).Error; err != nil {
 		log.Printf("add history failed,err=%v", err)
 	}
+	msg.HistoryId = h.Id
+}
+
+// getVendorId returns the vendor id recorded by a previous message of tenant
+func getVendorId(tenant string, historyId int) (string, error) {
+	h := &History{}
+	if err := db.Model(&History{}).Where("id = ? AND tenant = ?", historyId, tenant).First(h).Error; err != nil {
+		return "", fmt.Errorf("cannot find history with id %d, err=%w", historyId, err)
+	}
+	return h.VendorId, nil
 }
 
 // QueryHistory
 //
 //	@Tags			send
-//	@Description	query message history
-//	@Param			page_index	query		int		true	"page_index"
-//	@Param			page_size	query		int		true	"page_size"
-//	@Param			start		query		int		false	"start time"
-//	@Param			end			query		int		false	"end time"
-//	@Param			status		query		string	false	"false failed, true sent successfully"
-//	@Param			sender		query		string	false	"sender name"
-//	@Param			content		query		string	false	"content"
-//	@Success		200			{object}	map[string]any
+//	@Description	query message history of the authenticated tenant
+//	@Param			page_index			query		int		true	"page_index"
+//	@Param			page_size			query		int		true	"page_size"
+//	@Param			start				query		int		false	"start time"
+//	@Param			end					query		int		false	"end time"
+//	@Param			status				query		string	false	"false failed, true sent successfully"
+//	@Param			sender				query		string	false	"sender name"
+//	@Param			content				query		string	false	"content"
+//	@Param			recipient			query		string	false	"histories sent to the recipient"
+//	@Param			recipient_status	query		string	false	"histories with recipients in status separated by comma, ie. pending sent delivered failed"
+//	@Success		200					{object}	map[string]any
 //	@Router			/v1/history [GET]
 func QueryHistory(ctx *gin.Context) {
 	pageIndex, pageSize := cast.ToInt(ctx.Query("page_index")), cast.ToInt(ctx.Query("page_size"))
-	q := db.Model(&History{}).Offset((pageIndex - 1) * pageSize).Limit(pageSize)
+	q := db.Model(&History{}).Where("tenant = ?", tenantOf(ctx)).Offset((pageIndex - 1) * pageSize).Limit(pageSize)
 	if v, ok := ctx.GetQuery("start"); ok {
 		q = q.Where("created_at >= ?", v)
 	}
@@ -101,6 +131,19 @@ func QueryHistory(ctx *gin.Context) {
 			q = q.Where(fmt.Sprintf("JSON_EXTRACT(`message`,'$.%s') LIKE ?", k), fmt.Sprintf("%%%s%%", v))
 		}
 	}
+	// recipients are filtered too, eg. recipient_status=failed returns the histories and the recipients who did not get them
+	conds, args := make([]string, 0), make([]any, 0)
+	if v, ok := ctx.GetQuery("recipient"); ok {
+		conds, args = append(conds, "recipient = ?"), append(args, v)
+	}
+	if v, ok := ctx.GetQuery("recipient_status"); ok {
+		conds, args = append(conds, "status IN ?"), append(args, strings.Split(v, ","))
+	}
+	preload := make([]any, 0)
+	if len(conds) > 0 {
+		preload = append([]any{strings.Join(conds, " AND ")}, args...)
+		q = q.Where("id IN (?)", db.Model(&Recipient{}).Select("history_id").Where(preload[0], preload[1:]...))
+	}
 	if v, ok := ctx.GetQuery("sort"); ok {
 		if len(v) > 1 {
 			q = q.Order(fmt.Sprintf("%s %s", v[1:], lo.Ternary(v[:1] == "+", "ASC", "DESC")))
@@ -114,7 +157,7 @@ func QueryHistory(ctx *gin.Context) {
 		return q.Session(cfg).Count(&count).Error
 	})
 	eg.Go(func() error {
-		return q.Session(cfg).Find(&histories).Error
+		return q.Session(cfg).Preload("Recipients", preload...).Find(&histories).Error
 	})
 
 	if err := eg.Wait(); err != nil {
@@ -128,17 +171,44 @@ func QueryHistory(ctx *gin.Context) {
 	})
 }
 
-func RecordHttpReq(msg *message) resty.PreRequestHook {
-	return func(c *resty.Client, r *http.Request) error {
-		curl, _ := http2curl.GetCurlCommand(r)
-		msg.Req = curl.String()
+// attemptKey is the context key of the attempt of a request, it is set by rc before each attempt
+type attemptKey struct{}
+
+func setAttempt(_ *resty.Client, r *resty.Request) error {
+	r.SetContext(context.WithValue(r.Context(), attemptKey{}, r.Attempt))
+	return nil
+}
+
+// messageKey is the context key of the message which requests are sent for
+type messageKey struct{}
+
+// recordedR returns a request of rc, the curl command of it is recorded in msg.Req by RecordHttpReq
+func recordedR(msg *message) *resty.Request {
+	return rc.R().SetContext(context.WithValue(context.Background(), messageKey{}, msg))
+}
+
+// RecordHttpReq is the pre-request hook of rc recording requests created by recordedR, retries are published as events
+func RecordHttpReq(c *resty.Client, r *http.Request) error {
+	msg, ok := r.Context().Value(messageKey{}).(*message)
+	if !ok {
 		return nil
 	}
+	curl, _ := http2curl.GetCurlCommand(r)
+	if attempt, _ := r.Context().Value(attemptKey{}).(int); attempt > 1 {
+		publishEvent(eventRetried, msg)
+	}
+	msg.Req = curl.String()
+	return nil
 }
 
-func RecordEmailReq(msg *message, m *gomail.Message) {
+func RecordEmailReq(msg *message, ms ...*gomail.Message) {
 	buf := &bytes.Buffer{}
-	m.WriteTo(buf)
+	for i, m := range ms {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		m.WriteTo(buf)
+	}
 	msg.Req = buf.String()
 }
 
@@ -0,0 +1,99 @@
+package send
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/spf13/cast"
+)
+
+func TestRecordHttpReqRetried(t *testing.T) {
+	ch := make(chan *event, 10)
+	subMtx.Lock()
+	subscribers[ch] = struct{}{}
+	subMtx.Unlock()
+	defer func() {
+		subMtx.Lock()
+		delete(subscribers, ch)
+		subMtx.Unlock()
+	}()
+
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if r.URL.Query().Get("fail") != "" && attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	client := resty.New().
+		SetRetryCount(2).
+		SetRetryWaitTime(time.Millisecond).
+		SetRetryMaxWaitTime(time.Millisecond).
+		AddRetryCondition(func(r *resty.Response, err error) bool { return err != nil || !r.IsSuccess() }).
+		OnBeforeRequest(setAttempt).
+		SetPreRequestHook(RecordHttpReq)
+	msg := &message{Id: "1"}
+
+	// identical requests are not retries
+	for i := 0; i < 2; i++ {
+		client.R().SetContext(context.WithValue(context.Background(), messageKey{}, msg)).Get(srv.URL)
+	}
+	if len(ch) != 0 {
+		t.Fatalf("retried events = %d, want 0", len(ch))
+	}
+
+	attempts = 0
+	client.R().SetContext(context.WithValue(context.Background(), messageKey{}, msg)).Get(srv.URL + "?fail=1")
+	if len(ch) != 2 {
+		t.Fatalf("retried events = %d, want 2", len(ch))
+	}
+	if e := <-ch; e.Type != eventRetried || e.Id != msg.Id {
+		t.Errorf("event = %+v", e)
+	}
+}
+
+func TestAddHistoryWithoutAttachmentContent(t *testing.T) {
+	msg := &message{Id: newMessageId(), Sender: "mail", Attachments: []*attachment{{Name: "a.txt", Base64: "aGVsbG8="}, {Url: "https://xxx.com/b.png"}}}
+	AddHistory(msg)
+
+	h := &History{}
+	if err := db.Where("message_id = ?", msg.Id).First(h).Error; err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(h.Message, "aGVsbG8=") || !strings.Contains(h.Message, "a.txt") || !strings.Contains(h.Message, "https://xxx.com/b.png") {
+		t.Errorf("message = %s", h.Message)
+	}
+	if msg.Attachments[0].Base64 == "" {
+		t.Errorf("attachments of message are changed")
+	}
+}
+
+func TestRecordHttpReqConcurrently(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	msgs := make([]*message, 20)
+	wg := &sync.WaitGroup{}
+	for i := range msgs {
+		msgs[i] = &message{Id: cast.ToString(i)}
+		wg.Add(1)
+		go func(m *message) {
+			defer wg.Done()
+			recordedR(m).Get(srv.URL + "?id=" + m.Id)
+		}(msgs[i])
+	}
+	wg.Wait()
+	for _, m := range msgs {
+		if !strings.Contains(m.Req, "?id="+m.Id+"'") {
+			t.Errorf("req of message %s = %s", m.Id, m.Req)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package send
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+func init() {
+	registered["rocketchat"] = func(conf map[string]string) sender {
+		return &rocketchat{conf: conf}
+	}
+}
+
+type rocketchat struct {
+	conf map[string]string
+}
+
+// send rocket.chat incoming webhook message
+//
+//	https://docs.rocket.chat/use-rocket.chat/workspace-administration/integrations#incoming-webhook-script
+func (r *rocketchat) send(msg *message) error {
+	if msg.Simple {
+		switch msg.MsgType {
+		case simpleText, simpleMarkdown:
+			msg.ContentMap = map[string]any{
+				"text": msg.Content,
+			}
+		default:
+			return fmt.Errorf("sender type %s does not support simple type %s", r.conf["type"], msg.MsgType)
+		}
+	}
+
+	if len(msg.Ats) > 0 {
+		switch msg.MsgType {
+		case simpleText, simpleMarkdown:
+			msg.ContentMap["text"] = fmt.Sprintf("%v \n %s",
+				msg.ContentMap["text"],
+				strings.Join(lo.Map(msg.Ats, func(s string, _ int) string {
+					return fmt.Sprintf("@%s", strings.TrimPrefix(s, "@"))
+				}), " "))
+		}
+	}
+
+	resp, err := recordedR(msg).
+		SetBody(lo.Assign(msg.ExtraMap, msg.ContentMap)).
+		Post(r.conf["url"])
+
+	RecordResp(msg, err, resp)
+
+	return handleErr("send to rocketchat failed", err, resp, func(dt map[string]any) bool { return dt["success"] == true })
+}
+
+func (r *rocketchat) getConf() map[string]string {
+	return r.conf
+}
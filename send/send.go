@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 	"reflect"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -20,6 +21,8 @@ import (
 const (
 	simpleText     = "text"
 	simpleMarkdown = "markdown"
+	simpleImage    = "image"
+	simpleFile     = "file"
 )
 
 var (
@@ -35,29 +38,59 @@ type sender interface {
 	getConf() map[string]string
 }
 
+// senderKey is the key of sender in name2sender, names of senders of tenants are prefixed with their tenants
+func senderKey(tenant, name string) string {
+	return lo.Ternary(tenant == "", name, tenant+"/"+name)
+}
+
+func getSender(tenant, name string) (sender, bool) {
+	s, ok := name2sender[senderKey(tenant, name)]
+	return s, ok && s != nil
+}
+
+// tenantOf returns the authenticated tenant, it is empty for the default tenant
+func tenantOf(ctx *gin.Context) string {
+	return ctx.GetString(global.TenantKey)
+}
+
 type senderManager interface {
 	sender
 	getUIDByPhone(string) (string, error)
 }
 
 type message struct {
-	Sender     string         `json:"sender" validate:"required" example:"myWechatBot"`
-	MsgType    string         `json:"msgtype" validate:"required" example:"text"`
-	Content    string         `json:"content" validate:"required" example:"this is a text content"`
-	Title      string         `json:"title" validate:"optional" example:""`
-	Tos        []string       `json:"tos" validate:"optional" example:""`
-	Ccs        []string       `json:"ccs" validate:"optional" example:""`
-	Extra      string         `json:"extra" validate:"optional" example:"{\"enable_duplicate_check\": 1,\"duplicate_check_interval\": 1800}"`
-	Sync       bool           `json:"sync" validate:"optional" example:"true"`
-	Simple     bool           `json:"simple" validate:"optional" example:"true"`
-	Ats        []string       `json:"ats" validate:"optional" example:"xxx"`
-	AtMobiles  []string       `json:"at_mobiles" validate:"optional" example:"133123456789"`
-	ContentMap map[string]any `json:"-"`
-	ExtraMap   map[string]any `json:"-"`
-	Err        error          `json:"-"`
-	Req        string         `json:"-"`
-	Resp       string         `json:"-"`
-	ReceivedAt int64          `json:"-"`
+	Id          string         `json:"id" validate:"optional" example:""`
+	Sender      string         `json:"sender" validate:"required" example:"myWechatBot"`
+	MsgType     string         `json:"msgtype" validate:"required" example:"text"`
+	Content     string         `json:"content" validate:"required" example:"this is a text content"`
+	Title       string         `json:"title" validate:"optional" example:""`
+	Tos         []string       `json:"tos" validate:"optional" example:""`
+	Ccs         []string       `json:"ccs" validate:"optional" example:""`
+	Extra       string         `json:"extra" validate:"optional" example:"{\"enable_duplicate_check\": 1,\"duplicate_check_interval\": 1800}"`
+	Sync        bool           `json:"sync" validate:"optional" example:"true"`
+	Simple      bool           `json:"simple" validate:"optional" example:"true"`
+	Ats         []string       `json:"ats" validate:"optional" example:"xxx"`
+	AtMobiles   []string       `json:"at_mobiles" validate:"optional" example:"133123456789"`
+	Attachments []*attachment  `json:"attachments" validate:"optional"`
+	CallbackUrl string         `json:"callback_url" validate:"optional" example:"https://xxx.com/status"`
+	Category    string         `json:"category" validate:"optional" example:"marketing"`
+	Severity    string         `json:"severity" validate:"optional" example:"warning"`
+	ContentMap  map[string]any `json:"-"`
+	ExtraMap    map[string]any `json:"-"`
+	Err         error          `json:"-"`
+	Req         string         `json:"-"`
+	Resp        string         `json:"-"`
+	VendorId    string         `json:"-"`
+	Warn        string         `json:"-"`
+	Recipients  []*Recipient   `json:"-"`
+	HistoryId   int            `json:"-"`
+	Tenant      string         `json:"-"`
+	ReceivedAt  int64          `json:"-"`
+}
+
+// addWarn appends warn to the warnings of message
+func (m *message) addWarn(warn string) {
+	m.Warn = strings.Join(lo.Compact([]string{m.Warn, warn}), "; ")
 }
 
 type getUIDByPhoneReq struct {
@@ -67,6 +100,7 @@ type getUIDByPhoneReq struct {
 
 func init() {
 	rc.RetryCount = 3
+	rc.OnBeforeRequest(setAttempt).SetPreRequestHook(RecordHttpReq)
 	global.RegisterWatchCallbacks(func() {
 		confCh <- struct{}{}
 	})
@@ -101,7 +135,7 @@ func Start() error {
 //	@Accept			json
 //	@Produce		json
 //	@Param			body	body		message				true	" "
-//	@Success		200		{object}	map[string]string	"a map with msg info, eg. {msg:ok}"
+//	@Success		200		{object}	map[string]string	"a map with msg info and message id, eg. {msg:ok,id:xxx}"
 //	@Router			/v1/message [POST]
 func PushMessage(ctx *gin.Context) {
 	m := &message{}
@@ -110,33 +144,27 @@ func PushMessage(ctx *gin.Context) {
 		return
 	}
 	m.ReceivedAt = time.Now().Unix()
+	m.Id = lo.Ternary(m.Id != "", m.Id, newMessageId())
+	m.Tenant = tenantOf(ctx)
 	m.Ats = lo.Uniq(m.Ats)
 	m.AtMobiles = lo.Uniq(m.AtMobiles)
 
-	if s, ok := name2sender[m.Sender]; ok && s != nil && s.getConf()["type"] != "email" && !m.Simple {
-		if m.Content != "" {
-			if err := json.Unmarshal([]byte(cast.ToString(m.Content)), &m.ContentMap); err != nil {
-				ctx.AbortWithError(http.StatusBadRequest, err)
-				return
-			}
-		}
-	}
-	if m.Extra != "" {
-		if err := json.Unmarshal([]byte(cast.ToString(m.Extra)), &m.ExtraMap); err != nil {
-			ctx.AbortWithError(http.StatusBadRequest, err)
-			return
-		}
+	if err := parseMessage(m); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
 	}
 
 	if m.Sync {
 		if err := handleMessage(m); err != nil {
 			ctx.AbortWithError(http.StatusInternalServerError, err)
 			log.Println(err)
+			return
 		}
-		return
+	} else {
+		enqueue(m)
 	}
 
-	msgCh <- m
+	ctx.JSON(http.StatusOK, map[string]any{"id": m.Id})
 }
 
 // GetUIDByPhone
@@ -164,8 +192,8 @@ func GetUIDByPhone(ctx *gin.Context) {
 		ctx.AbortWithError(http.StatusBadRequest, err)
 		return
 	}
-	s, ok := name2sender[r.Sender]
-	if !ok || s == nil {
+	s, ok := getSender(tenantOf(ctx), r.Sender)
+	if !ok {
 		err = fmt.Errorf("cannot find sender with name %s", r.Sender)
 		return
 	}
@@ -174,27 +202,60 @@ func GetUIDByPhone(ctx *gin.Context) {
 		err = fmt.Errorf("sender with name %s and type %s does not support to query uid by phone", r.Sender, s.getConf()["type"])
 		return
 	}
-	uid, err := sm.getUIDByPhone(r.Phone)
+	uids, err := lookupUIDs(sm, []string{r.Phone}, nil)
 	if err != nil {
 		return
 	}
-	ctx.JSON(http.StatusOK, map[string]string{"uid": uid})
+	ctx.JSON(http.StatusOK, map[string]string{"uid": uids[r.Phone]})
+}
+
+// parseMessage parses json content and extra of m
+func parseMessage(m *message) error {
+	if s, ok := getSender(m.Tenant, m.Sender); ok && !lo.Contains([]string{"email", "tencentSms"}, s.getConf()["type"]) && !m.Simple {
+		if m.Content != "" {
+			if err := json.Unmarshal([]byte(cast.ToString(m.Content)), &m.ContentMap); err != nil {
+				return err
+			}
+		}
+	}
+	if m.Extra != "" {
+		if err := json.Unmarshal([]byte(cast.ToString(m.Extra)), &m.ExtraMap); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func handleErr(info string, e error, resp *resty.Response, isOk func(dt map[string]any) bool) error {
+	return checkResp(info, e, resp, func(code int) bool { return code == 200 }, isOk)
+}
+
+// handle2xxErr is the same as handleErr except that all 2xx http codes are accepted,
+// it is used for apis responding 201 or 202, eg. mattermost and pagerduty, and webhooks implemented by users
+func handle2xxErr(info string, e error, resp *resty.Response, isOk func(dt map[string]any) bool) error {
+	return checkResp(info, e, resp, func(code int) bool { return code >= 200 && code < 300 }, isOk)
+}
+
+func checkResp(info string, e error, resp *resty.Response, codeOk func(code int) bool, isOk func(dt map[string]any) bool) error {
 	if e != nil {
 		return e
 	}
 
 	dt := make(map[string]any)
 	_ = json.Unmarshal(resp.Body(), &dt)
-	if resp.StatusCode() != 200 || !isOk(dt) {
+	if !codeOk(resp.StatusCode()) || !isOk(dt) {
 		return fmt.Errorf("%s httpcode=%v resp=%s", info, resp.StatusCode(), global.RenderPretty(dt))
 	}
 
 	return nil
 }
 
+// getURL joins path to the base url configured by key, dft is used if it is not configured
+func getURL(conf map[string]string, key, dft, path string) string {
+	return strings.TrimSuffix(lo.Ternary(conf[key] != "", conf[key], dft), "/") + path
+}
+
 func handleConfig() {
 	confs, err := global.GetSenders()
 	if err != nil {
@@ -204,7 +265,7 @@ func handleConfig() {
 
 	valid := make(map[string]struct{})
 	for _, conf := range confs {
-		name := conf["name"]
+		name := senderKey(conf["tenant"], conf["name"])
 		valid[name] = struct{}{}
 		if s, ok := name2sender[name]; !ok || s == nil || !reflect.DeepEqual(conf, s.getConf()) {
 			f, ok := registered[conf["type"]]
@@ -230,17 +291,17 @@ func handleMessage(msg *message) (err error) {
 		if err != nil && !msg.Sync {
 			log.Println(err)
 		}
-		if msg.Err == nil {
-			msg.Err = err
-		}
-		AddHistory(msg)
+		finishMessage(msg, err)
 	}()
 
-	s, ok := name2sender[msg.Sender]
-	if !ok || s == nil {
+	s, ok := getSender(msg.Tenant, msg.Sender)
+	if !ok {
 		err = fmt.Errorf("cannot find sender with name %s", msg.Sender)
 		return
 	}
+	if err = resolveContacts(s, msg); err != nil || msg.suppressed() {
+		return
+	}
 
 	if err = s.send(msg); err != nil {
 		err = fmt.Errorf("send failed %w", err)
@@ -248,3 +309,14 @@ func handleMessage(msg *message) (err error) {
 
 	return
 }
+
+// finishMessage records the result of a sent message and notifies it
+func finishMessage(msg *message, err error) {
+	if msg.Err == nil {
+		msg.Err = err
+	}
+	fillRecipients(msg)
+	AddHistory(msg)
+	publishEvent(lo.Ternary(msg.suppressed(), eventSuppressed, lo.Ternary(msg.Err == nil, eventSent, eventFailed)), msg)
+	go notifyStatus(msg)
+}
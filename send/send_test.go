@@ -0,0 +1,13 @@
+package send
+
+import (
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	// history.db is created by init of record.go
+	_ = os.Remove("history.db")
+	os.Exit(code)
+}
@@ -0,0 +1,125 @@
+package send
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+
+	"github.com/veops/messenger/global"
+)
+
+const (
+	// respSummaryLength is the max length of vendor response in status webhooks
+	respSummaryLength = 1024
+)
+
+var (
+	// statusClient retries on failed responses too since receivers of status webhooks may be unavailable for a while,
+	// requests are signed before each attempt so that retries are not rejected for stale timestamps
+	statusClient = resty.New().
+		SetRetryCount(5).
+		SetRetryWaitTime(time.Second * 5).
+		SetRetryMaxWaitTime(time.Minute).
+		AddRetryCondition(func(r *resty.Response, err error) bool { return err != nil || !r.IsSuccess() }).
+		OnBeforeRequest(signAttempt)
+)
+
+type signingKey struct{}
+
+// signing is the secret and values to sign of a request of statusClient
+type signing struct {
+	secret string
+	body   map[string]string
+}
+
+// newMessageId returns a random uuid
+func newMessageId() string {
+	bs := make([]byte, 16)
+	_, _ = rand.Read(bs)
+	bs[6], bs[8] = bs[6]&0x0f|0x40, bs[8]&0x3f|0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", bs[0:4], bs[4:6], bs[6:8], bs[8:10], bs[10:])
+}
+
+// notifyStatus posts the final status of message to its callback_url and statusWebhooks of its tenant,
+// the body is signed with the secret of webhook or sign auth of the tenant in the same way as sign auth
+func notifyStatus(msg *message) {
+	tenant, err := global.GetTenant(msg.Tenant)
+	if err != nil {
+		log.Printf("get tenant %s failed, err=%v", msg.Tenant, err)
+		tenant = &global.Tenant{}
+	}
+	hooks := tenant.StatusWebhooks
+	if msg.CallbackUrl != "" {
+		hooks = append(hooks, map[string]string{"url": msg.CallbackUrl})
+	}
+	if len(hooks) <= 0 {
+		return
+	}
+
+	secret := signSecret(msg.Tenant)
+	resp := []rune(msg.Resp)
+	body := map[string]string{
+		"id":         msg.Id,
+		"history_id": cast.ToString(msg.HistoryId),
+		"sender":     msg.Sender,
+		"status":     lo.Ternary(msg.suppressed(), recipientSuppressed, lo.Ternary(msg.Err == nil, recipientSent, recipientFailed)),
+		"err":        lo.TernaryF(msg.Err == nil, func() string { return "" }, func() string { return msg.Err.Error() }),
+		"warn":       msg.Warn,
+		"vendor_id":  msg.VendorId,
+		"resp":       string(lo.Subset(resp, 0, respSummaryLength)),
+		"failed_recipients": strings.Join(lo.FilterMap(msg.Recipients, func(r *Recipient, _ int) (string, bool) {
+			return r.Recipient, r.Status == recipientFailed
+		}), ","),
+	}
+
+	for _, h := range hooks {
+		if h["senders"] != "" && !lo.Contains(strings.Split(h["senders"], ","), msg.Sender) {
+			continue
+		}
+		r := statusClient.R().SetBody(body)
+		signRequest(r, lo.Ternary(h["secret"] != "", h["secret"], secret), body)
+		resp, err := r.Post(h["url"])
+		if err = handle2xxErr("notify message status failed", err, resp, func(dt map[string]any) bool { return true }); err != nil {
+			log.Printf("notify status of message %s to %s failed, err=%v", msg.Id, h["url"], err)
+		}
+	}
+}
+
+// signSecret returns the secret of sign auth of tenant, it is empty if sign auth is not configured
+func signSecret(tenant string) string {
+	t, err := global.GetTenant(tenant)
+	if err != nil {
+		return ""
+	}
+	a, _ := lo.Find(t.Auths, func(a map[string]string) bool { return a["type"] == "sign" })
+	return a["secret"]
+}
+
+// signAttempt signs every attempt with a new ts and nonce, so retries are not rejected as replays
+func signAttempt(_ *resty.Client, r *resty.Request) error {
+	if s, ok := r.Context().Value(signingKey{}).(*signing); ok {
+		ts, nonce := cast.ToString(time.Now().Unix()), newMessageId()
+		r.SetHeaders(map[string]string{
+			"X-TS":    ts,
+			"X-Nonce": nonce,
+			"X-Sign":  global.Sign(s.secret, s.body, ts, nonce),
+		})
+	}
+	return nil
+}
+
+// signRequest makes statusClient set headers of sign auth with secret for each attempt of r,
+// body is the values to sign, the request is not signed if secret is empty
+func signRequest(r *resty.Request, secret string, body map[string]string) {
+	if secret == "" {
+		return
+	}
+	r.SetContext(context.WithValue(r.Context(), signingKey{}, &signing{secret: secret, body: body}))
+}
@@ -0,0 +1,43 @@
+package send
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/veops/messenger/global"
+)
+
+func TestSignRequestRetry(t *testing.T) {
+	client := resty.New().
+		SetRetryCount(2).
+		SetRetryWaitTime(time.Millisecond).
+		SetRetryMaxWaitTime(time.Millisecond).
+		AddRetryCondition(func(r *resty.Response, err error) bool { return err != nil || !r.IsSuccess() }).
+		OnBeforeRequest(signAttempt)
+	body := map[string]string{"id": "1"}
+	nonces := make([]string, 0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ts, nonce := r.Header.Get("X-TS"), r.Header.Get("X-Nonce")
+		if r.Header.Get("X-Sign") != global.Sign("secret", body, ts, nonce) {
+			t.Errorf("invalid signature of attempt %d", len(nonces)+1)
+		}
+		nonces = append(nonces, nonce)
+		if len(nonces) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	r := client.R().SetBody(body)
+	signRequest(r, "secret", body)
+	resp, err := r.Post(srv.URL)
+	if err != nil || resp.StatusCode() != http.StatusOK || len(nonces) != 3 {
+		t.Fatalf("post = %v %v, attempts = %d", resp, err, len(nonces))
+	}
+	if nonces[0] == nonces[1] || nonces[1] == nonces[2] {
+		t.Errorf("attempts are not signed again, nonces = %v", nonces)
+	}
+}
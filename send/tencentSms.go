@@ -0,0 +1,190 @@
+package send
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+)
+
+const (
+	tencentSmsUrl = "https://sms.tencentcloudapi.com"
+)
+
+func init() {
+	registered["tencentSms"] = func(conf map[string]string) sender {
+		return &tencentSms{conf: conf}
+	}
+}
+
+type tencentSms struct {
+	conf map[string]string
+}
+
+// send tencent cloud sms
+//
+//	https://cloud.tencent.com/document/api/382/55981
+func (t *tencentSms) send(msg *message) error {
+	params, err := t.templateParams(msg.Content)
+	if err != nil {
+		return err
+	}
+	bs, _ := json.Marshal(map[string]any{
+		"PhoneNumberSet":   msg.Tos,
+		"SmsSdkAppId":      t.conf["sdkAppId"],
+		"SignName":         t.conf["signName"],
+		"TemplateId":       t.conf["templateId"],
+		"TemplateParamSet": params,
+	})
+
+	endpoint := getURL(t.conf, "baseUrl", tencentSmsUrl, "/")
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	headers := map[string]string{
+		"Content-Type":   "application/json; charset=utf-8",
+		"X-TC-Action":    "SendSms",
+		"X-TC-Timestamp": cast.ToString(now.Unix()),
+		"X-TC-Version":   "2021-01-11",
+		"X-TC-Region":    lo.Ternary(t.conf["region"] != "", t.conf["region"], "ap-guangzhou"),
+	}
+	headers["Authorization"] = tc3Sign(t.conf["secretId"], t.conf["secretKey"], "sms", [][2]string{
+		{"content-type", headers["Content-Type"]},
+		{"host", u.Host},
+		{"x-tc-action", strings.ToLower(headers["X-TC-Action"])},
+	}, bs, now)
+
+	type res struct {
+		Response struct {
+			SendStatusSet []struct {
+				PhoneNumber string `json:"PhoneNumber"`
+				Code        string `json:"Code"`
+				Message     string `json:"Message"`
+			} `json:"SendStatusSet"`
+			Error *struct {
+				Code    string `json:"Code"`
+				Message string `json:"Message"`
+			} `json:"Error"`
+		} `json:"Response"`
+	}
+	r := &res{}
+
+	resp, err := recordedR(msg).
+		SetHeaders(headers).
+		SetBody(bs).
+		SetResult(r).
+		Post(endpoint)
+
+	RecordResp(msg, err, resp)
+
+	if err = handleErr("send to tencent sms failed", err, resp, func(dt map[string]any) bool {
+		return r.Response.Error == nil
+	}); err != nil {
+		return err
+	}
+
+	// tencent returns a status for every phone number, the request succeeds even if some of them failed
+	failed := make([]string, 0)
+	for _, s := range r.Response.SendStatusSet {
+		if s.Code != "Ok" {
+			failed = append(failed, fmt.Sprintf("%s: %s %s", s.PhoneNumber, s.Code, s.Message))
+			msg.failRecipient(recipientOf(msg.Tos, s.PhoneNumber), fmt.Sprintf("%s %s", s.Code, s.Message))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("send to tencent sms partially failed %d/%d: %s", len(failed), len(r.Response.SendStatusSet), strings.Join(failed, "; "))
+	}
+
+	return nil
+}
+
+func (t *tencentSms) getConf() map[string]string {
+	return t.conf
+}
+
+// templateParams accepts a json array like ["1234", "5"] or a json map like {"1": "1234", "2": "5"},
+// values of a map are ordered by their keys
+func (t *tencentSms) templateParams(content string) (params []string, err error) {
+	params = make([]string, 0)
+	if content == "" {
+		return
+	}
+
+	arr := make([]any, 0)
+	if err = json.Unmarshal([]byte(content), &arr); err == nil {
+		params = lo.Map(arr, func(v any, _ int) string { return cast.ToString(v) })
+		return
+	}
+
+	m := make(map[string]any)
+	if err = json.Unmarshal([]byte(content), &m); err != nil {
+		return nil, fmt.Errorf("template params of tencent sms must be a json array or map, err=%w", err)
+	}
+	ks := lo.Keys(m)
+	sort.Slice(ks, func(i, j int) bool {
+		ni, ei := cast.ToIntE(ks[i])
+		nj, ej := cast.ToIntE(ks[j])
+		if ei == nil && ej == nil {
+			return ni < nj
+		}
+		return ks[i] < ks[j]
+	})
+	params = lo.Map(ks, func(k string, _ int) string { return cast.ToString(m[k]) })
+
+	return
+}
+
+// tc3Sign returns the authorization of TC3-HMAC-SHA256, headers are lower case names and values to sign in order
+//
+//	https://cloud.tencent.com/document/api/382/52072
+func tc3Sign(secretId, secretKey, service string, headers [][2]string, payload []byte, now time.Time) string {
+	date := now.UTC().Format("2006-01-02")
+	signedHeaders := strings.Join(lo.Map(headers, func(h [2]string, _ int) string { return h[0] }), ";")
+	canonicalHeaders := strings.Join(lo.Map(headers, func(h [2]string, _ int) string { return h[0] + ":" + h[1] + "\n" }), "")
+	canonicalRequest := strings.Join([]string{
+		"POST",
+		"/",
+		"",
+		canonicalHeaders,
+		signedHeaders,
+		sha256Hex(payload),
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/tc3_request", date, service)
+	stringToSign := strings.Join([]string{
+		"TC3-HMAC-SHA256",
+		cast.ToString(now.Unix()),
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	secretDate := hmacSha256([]byte("TC3"+secretKey), date)
+	secretService := hmacSha256(secretDate, service)
+	secretSigning := hmacSha256(secretService, "tc3_request")
+	signature := hex.EncodeToString(hmacSha256(secretSigning, stringToSign))
+
+	return fmt.Sprintf("TC3-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		secretId, scope, signedHeaders, signature)
+}
+
+func sha256Hex(bs []byte) string {
+	h := sha256.Sum256(bs)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSha256(key []byte, s string) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(s))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,41 @@
+package send
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestTc3Sign uses the example of signature v3 in tencent cloud document
+//
+//	https://cloud.tencent.com/document/api/213/30654
+func TestTc3Sign(t *testing.T) {
+	payload := `{"Limit": 1, "Filters": [{"Values": ["\u672a\u547d\u540d"], "Name": "instance-name"}]}`
+	got := tc3Sign("AKIDz8krbsJ5yKBZQpn74WFkmLPx3EXAMPLE", "Gu5t9xGARNpq86cd98joQYCN3EXAMPLE", "cvm", [][2]string{
+		{"content-type", "application/json; charset=utf-8"},
+		{"host", "cvm.tencentcloudapi.com"},
+	}, []byte(payload), time.Unix(1551113065, 0))
+	want := "TC3-HMAC-SHA256 Credential=AKIDz8krbsJ5yKBZQpn74WFkmLPx3EXAMPLE/2019-02-25/cvm/tc3_request, " +
+		"SignedHeaders=content-type;host, Signature=72e494ea809ad7a8c8f7a4507b9bddcbaa8e581f516e8da2f66e2c5a96525168"
+	if got != want {
+		t.Errorf("tc3Sign = %s, want %s", got, want)
+	}
+}
+
+func TestTencentSmsTemplateParams(t *testing.T) {
+	ts := &tencentSms{}
+	for content, want := range map[string]string{
+		``:                                ``,
+		`["1234", 5]`:                     `1234,5`,
+		`{"2": "5", "1": "1234"}`:         `1234,5`,
+		`{"10": "c", "2": "b", "1": "a"}`: `a,b,c`,
+	} {
+		params, err := ts.templateParams(content)
+		if err != nil || strings.Join(params, ",") != want {
+			t.Errorf("templateParams(%s) = %v %v, want %s", content, params, err, want)
+		}
+	}
+	if _, err := ts.templateParams(`1234`); err == nil {
+		t.Errorf("templateParams of plain text should fail")
+	}
+}
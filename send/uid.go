@@ -0,0 +1,160 @@
+package send
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/samber/lo"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	uidCacheTTL = time.Hour * 24
+)
+
+// uidLooker is implemented by senders which could query uids of phones and emails in batch, eg. feishuApp
+type uidLooker interface {
+	sender
+	// lookupUIDs returns a map with phone or email as key and uid as value, the ones not found are omitted
+	lookupUIDs(phones, emails []string) (map[string]string, error)
+}
+
+// UID caches uids queried from vendors, key is a phone or an email
+type UID struct {
+	Id        int    `gorm:"column:id" json:"id"`
+	Sender    string `gorm:"column:sender;uniqueIndex:idx_uid_sender_key" json:"sender"`
+	Key       string `gorm:"column:key;uniqueIndex:idx_uid_sender_key" json:"key"`
+	Uid       string `gorm:"column:uid" json:"uid"`
+	UpdatedAt int64  `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (UID) TableName() string {
+	return "uid"
+}
+
+type lookupUIDReq struct {
+	Sender string   `json:"sender" validate:"required" example:"myFeishuApp"`
+	Phones []string `json:"phones" validate:"optional" example:"133123456789"`
+	Emails []string `json:"emails" validate:"optional" example:"xxx@xxx.com"`
+}
+
+// LookupUID
+//
+//	@Tags			send
+//	@Description	get uids of users by their phones and emails, results are cached for 24 hours
+//	@Description	https://github.com/veops/messenger?tab=readme-ov-file#查询用户ID
+//	@Accept			json
+//	@Produce		json
+//	@Param			body	body		lookupUIDReq		true	" "
+//	@Success		200		{object}	map[string]any		"a map with msg info and uids, uids is a map with phone or email as key and uid as value"
+//	@Router			/v1/uid/lookup [POST]
+func LookupUID(ctx *gin.Context) {
+	r := &lookupUIDReq{}
+	if err := ctx.ShouldBindBodyWith(r, binding.JSON); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	s, ok := getSender(tenantOf(ctx), r.Sender)
+	if !ok {
+		ctx.AbortWithError(http.StatusBadRequest, fmt.Errorf("cannot find sender with name %s", r.Sender))
+		return
+	}
+	uids, err := lookupUIDs(s, r.Phones, r.Emails)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, map[string]any{"uids": uids})
+}
+
+// lookupUIDs returns uids of phones and emails from cache, the missing ones are queried with sender and cached
+func lookupUIDs(s sender, phones, emails []string) (map[string]string, error) {
+	// uids are cached per sender, senders of different tenants may have the same name
+	name, key := s.getConf()["name"], senderKey(s.getConf()["tenant"], s.getConf()["name"])
+	phones, emails = lo.Uniq(lo.Compact(phones)), lo.Uniq(lo.Compact(emails))
+	cached := make([]*UID, 0)
+	err := db.Where("sender = ? AND `key` IN ? AND updated_at >= ?", key, append(phones, emails...), time.Now().Add(-uidCacheTTL).Unix()).
+		Find(&cached).Error
+	if err != nil {
+		return nil, err
+	}
+	res := lo.SliceToMap(cached, func(u *UID) (string, string) { return u.Key, u.Uid })
+	phones = lo.Filter(phones, func(p string, _ int) bool { return res[p] == "" })
+	emails = lo.Filter(emails, func(e string, _ int) bool { return res[e] == "" })
+	if len(phones) <= 0 && len(emails) <= 0 {
+		return res, nil
+	}
+
+	found := make(map[string]string)
+	switch v := s.(type) {
+	case uidLooker:
+		if found, err = v.lookupUIDs(phones, emails); err != nil {
+			return nil, err
+		}
+	case senderManager:
+		if len(emails) > 0 {
+			return nil, fmt.Errorf("sender with name %s and type %s does not support to query uid by email", name, s.getConf()["type"])
+		}
+		for _, p := range phones {
+			uid, err := v.getUIDByPhone(p)
+			if err != nil {
+				return nil, err
+			}
+			found[p] = uid
+		}
+	default:
+		return nil, fmt.Errorf("sender with name %s and type %s does not support to query uid", name, s.getConf()["type"])
+	}
+
+	now := time.Now().Unix()
+	rows := make([]*UID, 0)
+	for k, uid := range found {
+		if uid == "" {
+			continue
+		}
+		res[k] = uid
+		rows = append(rows, &UID{Sender: key, Key: k, Uid: uid, UpdatedAt: now})
+	}
+	if len(rows) > 0 {
+		err = db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "sender"}, {Name: "key"}},
+			DoUpdates: clause.AssignmentColumns([]string{"uid", "updated_at"}),
+		}).Create(rows).Error
+	}
+
+	return res, err
+}
+
+// atMobilesToAts converts at_mobiles to uids with sender s and appends them to ats, mobiles not found are set in warn
+func atMobilesToAts(s sender, msg *message) error {
+	if lo.Contains(msg.AtMobiles, "@all") {
+		msg.Ats = append(msg.Ats, "@all")
+	}
+	mobiles := lo.Without(msg.AtMobiles, "@all")
+	if len(mobiles) <= 0 {
+		return nil
+	}
+	uids, err := lookupUIDs(s, mobiles, nil)
+	if err != nil {
+		return err
+	}
+	missing := make([]string, 0)
+	for _, m := range mobiles {
+		if uid, ok := uids[m]; ok {
+			msg.Ats = append(msg.Ats, uid)
+		} else {
+			missing = append(missing, m)
+		}
+	}
+	msg.Ats = lo.Uniq(msg.Ats)
+	if len(missing) > 0 {
+		msg.addWarn(fmt.Sprintf("cannot find uids of at_mobiles %s", strings.Join(missing, ",")))
+	}
+
+	return nil
+}
@@ -1,21 +1,31 @@
 package send
 
 import (
+	"bytes"
+	"crypto/hmac"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/go-resty/resty/v2"
 	"github.com/samber/lo"
 	"github.com/spf13/cast"
 )
 
 const (
-	wechatTokenURL  = "https://qyapi.weixin.qq.com/cgi-bin/gettoken"
-	wechatSendURL   = "https://qyapi.weixin.qq.com/cgi-bin/message/send"
-	wechatGetUIDURL = "https://qyapi.weixin.qq.com/cgi-bin/user/getuserid"
+	wechatBaseURL        = "https://qyapi.weixin.qq.com"
+	wechatTokenPath      = "/cgi-bin/gettoken"
+	wechatSendPath       = "/cgi-bin/message/send"
+	wechatGetUIDPath     = "/cgi-bin/user/getuserid"
+	wechatUploadPath     = "/cgi-bin/media/upload"
+	wechatRecallPath     = "/cgi-bin/message/recall"
+	wechatUpdateCardPath = "/cgi-bin/message/update_template_card"
+
+	wechatTemplateCard = "template_card"
 )
 
 func init() {
@@ -31,7 +41,7 @@ type wechatApp struct {
 	tokenExpireAt time.Time
 }
 
-// send wechat app message
+// send wechat app message, tos are user ids, or department ids and tag ids with prefix party: and tag:, eg. party:12 tag:3
 //
 //	https://developer.work.weixin.qq.com/document/path/90236
 func (w *wechatApp) send(msg *message) (err error) {
@@ -39,35 +49,241 @@ func (w *wechatApp) send(msg *message) (err error) {
 		return
 	}
 
+	extra := msg.ExtraMap
 	if msg.Simple {
 		switch msg.MsgType {
 		case simpleText, simpleMarkdown:
 			msg.ContentMap = map[string]any{
 				"content": msg.Content,
 			}
+		case wechatTemplateCard:
+			// card_action is required by text notice cards
+			if cast.ToString(msg.ExtraMap["url"]) == "" {
+				return fmt.Errorf("url in extra is required by simple %s, it is the url to open when the card is clicked", wechatTemplateCard)
+			}
+			msg.ContentMap = map[string]any{
+				"card_type":      "text_notice",
+				"main_title":     map[string]any{"title": msg.Title},
+				"sub_title_text": msg.Content,
+				"card_action":    map[string]any{"type": 1, "url": msg.ExtraMap["url"]},
+			}
+			extra = lo.OmitByKeys(extra, []string{"url"})
+		case simpleImage, simpleFile:
+			msg.ContentMap = make(map[string]any)
 		default:
 			return fmt.Errorf("sender type %s does not support simple type %s", w.conf["type"], msg.MsgType)
 		}
 	}
-	resp, err := rc.SetPreRequestHook(RecordHttpReq(msg)).R().
+
+	if len(msg.Attachments) > 0 {
+		if err = w.attach(msg); err != nil {
+			return
+		}
+	}
+
+	body := map[string]any{
+		"agentid":   w.conf["agentid"],
+		"msgtype":   msg.MsgType,
+		msg.MsgType: msg.ContentMap,
+	}
+	users, parties, tags := wechatReceivers(msg.Tos)
+	for k, v := range map[string][]string{"touser": users, "toparty": parties, "totag": tags} {
+		if len(v) > 0 {
+			body[k] = strings.Join(v, "|")
+		}
+	}
+
+	type res struct {
+		InvalidUser    string `json:"invaliduser"`
+		InvalidParty   string `json:"invalidparty"`
+		InvalidTag     string `json:"invalidtag"`
+		UnlicensedUser string `json:"unlicenseduser"`
+		MsgId          string `json:"msgid"`
+	}
+	r := &res{}
+
+	resp, err := recordedR(msg).
 		SetQueryParam("access_token", w.token).
-		SetBody(lo.Assign(msg.ExtraMap, map[string]any{
-			"touser":    strings.Join(msg.Tos, "|"),
-			"agentid":   w.conf["agentid"],
-			"msgtype":   msg.MsgType,
-			msg.MsgType: msg.ContentMap,
-		})).
-		Post(wechatSendURL)
+		SetBody(lo.Assign(extra, body)).
+		SetResult(r).
+		Post(w.url(wechatSendPath))
 
 	RecordResp(msg, err, resp)
 
-	return handleErr("send to wechat app failed", err, resp, func(dt map[string]any) bool { return dt["errcode"] == 0.0 })
+	if err = handleErr("send to wechat app failed", err, resp, func(dt map[string]any) bool { return dt["errcode"] == 0.0 }); err != nil {
+		return
+	}
+
+	msg.VendorId = r.MsgId
+	// the message is still sent to the valid ones if some of the receivers are invalid
+	warns := make([]string, 0)
+	for _, kv := range [][2]string{
+		{"invaliduser", r.InvalidUser},
+		{"invalidparty", r.InvalidParty},
+		{"invalidtag", r.InvalidTag},
+		{"unlicenseduser", r.UnlicensedUser},
+	} {
+		if kv[1] != "" {
+			warns = append(warns, fmt.Sprintf("%s=%s", kv[0], kv[1]))
+		}
+	}
+	msg.addWarn(strings.Join(warns, "; "))
+	// prefix, ids separated by | and the reason
+	for _, v := range [][3]string{
+		{"", r.InvalidUser, "invalid user"},
+		{"", r.UnlicensedUser, "unlicensed user"},
+		{"party:", r.InvalidParty, "invalid party"},
+		{"tag:", r.InvalidTag, "invalid tag"},
+	} {
+		for _, id := range strings.Split(v[1], "|") {
+			if id == "" {
+				continue
+			}
+			to := v[0] + id
+			// users may be sent with prefix user:
+			if v[0] == "" && !lo.Contains(msg.Tos, id) && lo.Contains(msg.Tos, "user:"+id) {
+				to = "user:" + id
+			}
+			msg.failRecipient(to, v[2])
+		}
+	}
+
+	return
 }
 
 func (w *wechatApp) getConf() map[string]string {
 	return w.conf
 }
 
+// update updates the buttons or the whole template card, msgtype is button or template_card
+//
+//	https://developer.work.weixin.qq.com/document/path/94888
+func (w *wechatApp) update(h *History, origin *message, msg *message) (err error) {
+	if err = w.checkToken(); err != nil {
+		return
+	}
+
+	body := map[string]any{
+		"agentid":       w.conf["agentid"],
+		"response_code": historyRespBody(h)["response_code"],
+	}
+	switch msg.MsgType {
+	case "button":
+		body["button"] = lo.Ternary(msg.Simple, map[string]any{"replace_name": msg.Content}, msg.ContentMap)
+	case wechatTemplateCard:
+		body[wechatTemplateCard] = msg.ContentMap
+	default:
+		return fmt.Errorf("sender type %s does not support to update with message type %s", w.conf["type"], msg.MsgType)
+	}
+	users, parties, tags := wechatReceivers(origin.Tos)
+	if lo.Contains(users, "@all") {
+		body["atall"] = 1
+	}
+	for k, v := range map[string][]string{"userids": users, "partyids": parties, "tagids": tags} {
+		if len(v) > 0 && !lo.Contains(v, "@all") {
+			body[k] = v
+		}
+	}
+
+	resp, err := rc.R().
+		SetQueryParam("access_token", w.token).
+		SetBody(lo.Assign(msg.ExtraMap, body)).
+		Post(w.url(wechatUpdateCardPath))
+
+	return handleErr("update wechat app template card failed", err, resp, func(dt map[string]any) bool { return dt["errcode"] == 0.0 })
+}
+
+// recall
+//
+//	https://developer.work.weixin.qq.com/document/path/94867
+func (w *wechatApp) recall(h *History, origin *message) (err error) {
+	if err = w.checkToken(); err != nil {
+		return
+	}
+
+	resp, err := rc.R().
+		SetQueryParam("access_token", w.token).
+		SetBody(map[string]any{"msgid": h.VendorId}).
+		Post(w.url(wechatRecallPath))
+
+	return handleErr("recall wechat app message failed", err, resp, func(dt map[string]any) bool { return dt["errcode"] == 0.0 })
+}
+
+// attach uploads the attachment as temporary media and puts its media_id into content
+//
+//	https://developer.work.weixin.qq.com/document/path/90253
+func (w *wechatApp) attach(msg *message) (err error) {
+	if !lo.Contains([]string{simpleImage, "voice", "video", simpleFile}, msg.MsgType) {
+		return fmt.Errorf("sender type %s does not support attachments with message type %s", w.conf["type"], msg.MsgType)
+	}
+
+	mediaId, err := uploadAttachment(msg, func(name string, bs []byte) (string, error) {
+		resp, err := rc.R().
+			SetQueryParams(map[string]string{
+				"access_token": w.token,
+				"type":         msg.MsgType,
+			}).
+			SetFileReader("media", name, bytes.NewReader(bs)).
+			Post(w.url(wechatUploadPath))
+		if err = handleErr("upload media to wechat app failed", err, resp, func(dt map[string]any) bool { return dt["errcode"] == 0.0 }); err != nil {
+			return "", err
+		}
+		dt := make(map[string]any)
+		_ = json.Unmarshal(resp.Body(), &dt)
+		return cast.ToString(dt["media_id"]), nil
+	})
+	if err != nil {
+		return
+	}
+	msg.ContentMap = lo.Assign(msg.ContentMap, map[string]any{"media_id": mediaId})
+
+	return
+}
+
+// callback verifies and decrypts wechat callbacks with callbackToken and callbackAesKey in conf,
+// GET is the url verification and POST is the event, eg. template_card_event of button clicks
+//
+//	https://developer.work.weixin.qq.com/document/path/90930
+//	https://developer.work.weixin.qq.com/document/path/90240#模板卡片事件推送
+func (w *wechatApp) callback(ctx *gin.Context) (event map[string]any, key string, err error) {
+	encrypted := ctx.Query("echostr")
+	if ctx.Request.Method == http.MethodPost {
+		body := struct {
+			Encrypt string `xml:"Encrypt"`
+		}{}
+		if err = ctx.ShouldBindXML(&body); err != nil {
+			return
+		}
+		encrypted = body.Encrypt
+	}
+	if w.conf["callbackToken"] == "" {
+		return nil, "", fmt.Errorf("callbackToken is required to verify callbacks")
+	}
+	if !hmac.Equal([]byte(ctx.Query("msg_signature")), []byte(wxSignature(w.conf["callbackToken"], ctx.Query("timestamp"), ctx.Query("nonce"), encrypted))) {
+		return nil, "", fmt.Errorf("invalid signature")
+	}
+	bs, receiveId, err := wxDecrypt(w.conf["callbackAesKey"], encrypted)
+	if err != nil {
+		return
+	}
+	if receiveId != w.conf["corpid"] {
+		return nil, "", fmt.Errorf("invalid receive id %s", receiveId)
+	}
+
+	if ctx.Request.Method != http.MethodPost {
+		ctx.String(http.StatusOK, string(bs))
+		return nil, "", nil
+	}
+
+	if event, err = xmlToMap(bs); err != nil {
+		return
+	}
+	key = lo.Ternary(cast.ToString(event["TaskId"]) != "", cast.ToString(event["TaskId"]), cast.ToString(event["MsgId"]))
+	ctx.String(http.StatusOK, "")
+
+	return
+}
+
 // getUIDByPhone
 //
 //	https://developer.work.weixin.qq.com/document/path/95402
@@ -87,7 +303,7 @@ func (w *wechatApp) getUIDByPhone(phone string) (uid string, err error) {
 			"mobile": phone,
 		}).
 		SetResult(r).
-		Post(wechatGetUIDURL)
+		Post(w.url(wechatGetUIDPath))
 
 	if err = handleErr("get uid by phone with wechat app failed", err, resp, func(dt map[string]any) bool { return dt["errcode"] == 0.0 }); err != nil {
 		return
@@ -98,6 +314,28 @@ func (w *wechatApp) getUIDByPhone(phone string) (uid string, err error) {
 	return
 }
 
+// url uses baseUrl in conf for private deployments
+func (w *wechatApp) url(path string) string {
+	return getURL(w.conf, "baseUrl", wechatBaseURL, path)
+}
+
+// wechatReceivers splits tos into user ids, department ids with prefix party: and tag ids with prefix tag:
+func wechatReceivers(tos []string) (users, parties, tags []string) {
+	users, parties, tags = make([]string, 0), make([]string, 0), make([]string, 0)
+	for _, to := range tos {
+		switch {
+		case strings.HasPrefix(to, "party:"):
+			parties = append(parties, strings.TrimPrefix(to, "party:"))
+		case strings.HasPrefix(to, "tag:"):
+			tags = append(tags, strings.TrimPrefix(to, "tag:"))
+		default:
+			users = append(users, strings.TrimPrefix(to, "user:"))
+		}
+	}
+
+	return
+}
+
 func (w *wechatApp) checkToken() (err error) {
 	now := time.Now()
 	if !(w.token == "" || w.tokenExpireAt.Before(now)) {
@@ -113,7 +351,7 @@ func (w *wechatApp) checkToken() (err error) {
 				"corpid":     w.conf["corpid"],
 				"corpsecret": w.conf["corpsecret"],
 			}).
-			Get(wechatTokenURL)
+			Get(w.url(wechatTokenPath))
 
 		if err = handleErr("wechat get access token failed", err, resp, func(dt map[string]any) bool { return dt["errcode"] == 0.0 }); err != nil {
 			return
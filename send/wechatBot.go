@@ -1,6 +1,9 @@
 package send
 
 import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"strings"
 
@@ -27,11 +30,25 @@ func (w *wechatBot) send(msg *message) error {
 			msg.ContentMap = map[string]any{
 				"content": msg.Content,
 			}
+		case simpleImage:
+			msg.ContentMap = make(map[string]any)
 		default:
 			return fmt.Errorf("sender type %s does not support simple type %s", w.conf["type"], msg.MsgType)
 		}
 	}
 
+	if msg.MsgType == simpleImage && len(msg.Attachments) > 0 {
+		_, bs, err := msg.Attachments[0].load()
+		if err != nil {
+			return err
+		}
+		sum := md5.Sum(bs)
+		msg.ContentMap = lo.Assign(msg.ContentMap, map[string]any{
+			"base64": base64.StdEncoding.EncodeToString(bs),
+			"md5":    hex.EncodeToString(sum[:]),
+		})
+	}
+
 	if len(msg.Ats) > 0 {
 		switch msg.MsgType {
 		case simpleText:
@@ -49,7 +66,7 @@ func (w *wechatBot) send(msg *message) error {
 		}
 	}
 
-	resp, err := rc.SetPreRequestHook(RecordHttpReq(msg)).R().
+	resp, err := recordedR(msg).
 		SetBody(lo.Assign(msg.ExtraMap, map[string]any{
 			"msgtype":   msg.MsgType,
 			msg.MsgType: msg.ContentMap,
@@ -0,0 +1,134 @@
+package send
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+)
+
+const (
+	wechatMpBaseURL       = "https://api.weixin.qq.com"
+	wechatMpTokenPath     = "/cgi-bin/token"
+	wechatMpTemplatePath  = "/cgi-bin/message/template/send"
+	wechatMpSubscribePath = "/cgi-bin/message/subscribe/bizsend"
+)
+
+func init() {
+	registered["wechatMp"] = func(conf map[string]string) sender {
+		return &wechatMp{conf: conf}
+	}
+}
+
+type wechatMp struct {
+	conf          map[string]string
+	mtx           sync.Mutex
+	token         string
+	tokenExpireAt time.Time
+}
+
+// send wechat official account message, one request is sent for each openid in tos
+//
+//	https://developers.weixin.qq.com/doc/offiaccount/Message_Management/Template_Message_Interface.html#发送模板消息
+//	https://developers.weixin.qq.com/doc/offiaccount/Subscription_Messages/api.html#send发送订阅通知
+func (w *wechatMp) send(msg *message) (err error) {
+	if err = w.checkToken(); err != nil {
+		return
+	}
+
+	path := ""
+	switch msg.MsgType {
+	case "template":
+		path = wechatMpTemplatePath
+	case "subscribe":
+		path = wechatMpSubscribePath
+	default:
+		return fmt.Errorf("sender type %s does not support message type %s", w.conf["type"], msg.MsgType)
+	}
+	if msg.ContentMap == nil {
+		msg.ContentMap = make(map[string]any)
+	}
+	if _, ok := msg.ContentMap["template_id"]; !ok {
+		msg.ContentMap["template_id"] = w.conf["templateId"]
+	}
+
+	msgIds, errs := make([]string, 0), make([]string, 0)
+	for _, to := range msg.Tos {
+		resp, err := recordedR(msg).
+			SetQueryParam("access_token", w.token).
+			SetBody(lo.Assign(msg.ExtraMap, msg.ContentMap, map[string]any{
+				"touser": to,
+			})).
+			Post(getURL(w.conf, "baseUrl", wechatMpBaseURL, path))
+
+		RecordResp(msg, err, resp)
+
+		if err = handleErr("send to wechat mp failed", err, resp, func(dt map[string]any) bool { return dt["errcode"] == 0.0 }); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", to, err))
+			msg.failRecipient(to, err)
+			continue
+		}
+
+		r := struct {
+			MsgId json.Number `json:"msgid"`
+		}{}
+		_ = json.Unmarshal(resp.Body(), &r)
+		if r.MsgId != "" {
+			msgIds = append(msgIds, r.MsgId.String())
+		}
+	}
+	msg.VendorId = strings.Join(msgIds, ",")
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	return
+}
+
+func (w *wechatMp) getConf() map[string]string {
+	return w.conf
+}
+
+// checkToken
+//
+//	https://developers.weixin.qq.com/doc/offiaccount/Basic_Information/Get_access_token.html
+func (w *wechatMp) checkToken() (err error) {
+	now := time.Now()
+	if !(w.token == "" || w.tokenExpireAt.Before(now)) {
+		return nil
+	}
+
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.token == "" || w.tokenExpireAt.Before(now) {
+		var resp *resty.Response
+		resp, err = rc.R().
+			SetQueryParams(map[string]string{
+				"grant_type": "client_credential",
+				"appid":      w.conf["appid"],
+				"secret":     w.conf["secret"],
+			}).
+			Get(getURL(w.conf, "baseUrl", wechatMpBaseURL, wechatMpTokenPath))
+
+		// errcode is not returned when successful
+		if err = handleErr("wechat mp get access token failed", err, resp, func(dt map[string]any) bool {
+			v, ok := dt["errcode"]
+			return !ok || v == 0.0
+		}); err != nil {
+			return
+		}
+
+		dt := make(map[string]any)
+		_ = json.Unmarshal(resp.Body(), &dt)
+		w.token = cast.ToString(dt["access_token"])
+		w.tokenExpireAt = now.Add(time.Second * time.Duration(cast.ToInt((dt["expires_in"]))))
+	}
+
+	return
+}
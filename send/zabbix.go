@@ -0,0 +1,120 @@
+package send
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/samber/lo"
+)
+
+var (
+	// zabbixSeverities maps zabbix severities to the common ones used by pagerduty and opsgenie
+	zabbixSeverities = map[string]string{
+		"Not classified": "info",
+		"Information":    "info",
+		"Warning":        "warning",
+		"Average":        "error",
+		"High":           "critical",
+		"Disaster":       "critical",
+	}
+)
+
+// zabbixEvent is the params of media type webhook, values are zabbix macros, eg. event_id is {EVENT.ID}
+type zabbixEvent struct {
+	EventId       string `json:"event_id" example:"{EVENT.ID}"`
+	EventName     string `json:"event_name" example:"{EVENT.NAME}"`
+	EventSeverity string `json:"event_severity" example:"{EVENT.SEVERITY}"`
+	EventValue    string `json:"event_value" example:"{EVENT.VALUE}"`
+	EventDate     string `json:"event_date" example:"{EVENT.DATE}"`
+	EventTime     string `json:"event_time" example:"{EVENT.TIME}"`
+	RecoveryDate  string `json:"event_recovery_date" example:"{EVENT.RECOVERY.DATE}"`
+	RecoveryTime  string `json:"event_recovery_time" example:"{EVENT.RECOVERY.TIME}"`
+	EventTags     string `json:"event_tags" example:"{EVENT.TAGSJSON}"`
+	HostName      string `json:"host_name" example:"{HOST.NAME}"`
+	HostIp        string `json:"host_ip" example:"{HOST.IP}"`
+	Message       string `json:"message" example:"{ALERT.MESSAGE}"`
+	Url           string `json:"url" example:"{TRIGGER.URL}"`
+}
+
+// Zabbix
+//
+//	@Tags			integration
+//	@Description	receive events from zabbix media type webhook, render and send them with the sender in query or integration conf
+//	@Description	https://www.zabbix.com/documentation/current/en/manual/config/notifications/media/webhook
+//	@Accept			json
+//	@Produce		json
+//	@Param			sender		query		string				false	"sender name, default is the sender of integrations.zabbix in conf"
+//	@Param			template	query		string				false	"template name in templates of conf, default is the builtin template"
+//	@Param			body		body		zabbixEvent			true	" "
+//	@Success		200			{object}	map[string]string	"a map with msg info, eg. {msg:ok}"
+//	@Router			/v1/integrations/zabbix [POST]
+func Zabbix(ctx *gin.Context) {
+	e := &zabbixEvent{}
+	if err := ctx.ShouldBindBodyWith(e, binding.JSON); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	if e.EventId == "" {
+		ctx.AbortWithError(http.StatusBadRequest, fmt.Errorf("event_id is required"))
+		return
+	}
+
+	pushAlerts(ctx, "zabbix", e.toAlertGroup())
+}
+
+// toAlertGroup normalizes the zabbix event into alerts, event value 0 means the problem is resolved
+func (e *zabbixEvent) toAlertGroup() *alertGroup {
+	a := &alert{
+		Status: lo.Ternary(e.EventValue == "0", alertResolved, alertFiring),
+		Labels: map[string]string{
+			"alertname": e.EventName,
+			"host":      e.HostName,
+		},
+		Annotations: map[string]string{
+			"summary":     e.EventName,
+			"description": e.Message,
+		},
+		StartsAt:     zabbixTime(e.EventDate, e.EventTime),
+		EndsAt:       zabbixTime(e.RecoveryDate, e.RecoveryTime),
+		GeneratorURL: e.Url,
+		Fingerprint:  e.EventId,
+	}
+	if e.HostIp != "" {
+		a.Labels["instance"] = e.HostIp
+	}
+	if v := zabbixSeverities[e.EventSeverity]; v != "" {
+		a.Labels["severity"] = v
+	}
+	// {EVENT.TAGSJSON} is like [{"tag":"team","value":"db"}]
+	tags := make([]map[string]string, 0)
+	_ = json.Unmarshal([]byte(e.EventTags), &tags)
+	for _, t := range tags {
+		if t["tag"] != "" && a.Labels[t["tag"]] == "" {
+			a.Labels[t["tag"]] = t["value"]
+		}
+	}
+
+	return &alertGroup{
+		Status:            a.Status,
+		Receiver:          "zabbix",
+		GroupKey:          fmt.Sprintf("zabbix:%s", e.EventId),
+		GroupLabels:       map[string]string{"alertname": e.EventName},
+		CommonLabels:      a.Labels,
+		CommonAnnotations: a.Annotations,
+		Alerts:            []*alert{a},
+	}
+}
+
+// zabbixTime parses date and time macros of zabbix, eg. 2024.01.02 and 15:04:05 in local timezone
+func zabbixTime(date, tm string) time.Time {
+	t, err := time.ParseInLocation("2006.01.02 15:04:05", strings.TrimSpace(fmt.Sprintf("%s %s", date, tm)), time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}